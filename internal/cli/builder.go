@@ -1,15 +1,20 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"kook/internal/config"
 	"kook/internal/executor"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Execute is the main entry point for the CLI
@@ -26,12 +31,32 @@ func Execute(version string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	addGlobalFlags(rootCmd, cfg)
+
 	// Add all commands from config
 	for _, cmd := range cfg.Commands {
 		rootCmd.AddCommand(buildCommand(cfg, cmd))
 	}
 
-	return rootCmd.Execute()
+	return rootCmd.ExecuteContext(withDepRunner(context.Background()))
+}
+
+// addGlobalFlags registers the global options as persistent flags available
+// to every command
+func addGlobalFlags(rootCmd *cobra.Command, cfg *config.Config) {
+	for _, opt := range cfg.Options {
+		addFlag(rootCmd, rootCmd.PersistentFlags(), opt)
+		addCompletion(rootCmd, cfg, opt)
+	}
+}
+
+// addBuiltinFlags registers the flags kook provides to every command
+func addBuiltinFlags(rootCmd *cobra.Command) {
+	rootCmd.PersistentFlags().IntP("jobs", "j", 1, "Number of dependencies to run at the same time")
+	rootCmd.PersistentFlags().Bool("keep-going", false, "Keep running independent dependencies after one fails")
+	rootCmd.PersistentFlags().Bool("force", false, "Run commands even when their sources are up to date")
+	rootCmd.PersistentFlags().Bool("watch", false, "Run the command again when its watched files change")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Stop commands running longer than this, overriding their timeout (0 for no limit)")
 }
 
 func buildRootCommand(version string) *cobra.Command {
@@ -71,6 +96,13 @@ dynamic script generation.`,
 		},
 	}
 
+	addBuiltinFlags(rootCmd)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		keepGoing, _ := cmd.Flags().GetBool("keep-going")
+		return depRunnerFrom(cmd.Context()).configure(jobs, keepGoing)
+	}
+
 	rootCmd.AddCommand(buildCompletionCommand())
 
 	return rootCmd
@@ -86,7 +118,7 @@ func buildCommand(cfg *config.Config, cmd config.Command) *cobra.Command {
 			interactive, _ := cobraCmd.Flags().GetBool("interactive")
 
 			if interactive {
-				if err := promptForOptions(cobraCmd, cmd); err != nil {
+				if err := promptForOptions(cobraCmd, cfg, cmd); err != nil {
 					return fmt.Errorf("interactive prompt failed: %w", err)
 				}
 
@@ -97,10 +129,10 @@ func buildCommand(cfg *config.Config, cmd config.Command) *cobra.Command {
 						switch opt.Type {
 						case "bool":
 							isEmpty = false
-						case "str":
+						case "str", "path", "file", "dir":
 							val, _ := cobraCmd.Flags().GetString(opt.Name)
 							isEmpty = val == ""
-						case "int":
+						case "int", "duration", "count":
 							isEmpty = !cobraCmd.Flags().Changed(opt.Name)
 						case "float":
 							isEmpty = !cobraCmd.Flags().Changed(opt.Name)
@@ -111,29 +143,99 @@ func buildCommand(cfg *config.Config, cmd config.Command) *cobra.Command {
 						}
 					}
 				}
+
+				if err := validateOptionValues(cobraCmd, cfg, cmd); err != nil {
+					return err
+				}
 			}
 
-			return executor.Execute(cfg, cmd, cobraCmd)
+			run := func() error {
+				// Run dependencies first, each at most once per invocation
+				if err := runDeps(cobraCmd, cfg, cmd); err != nil {
+					return err
+				}
+
+				release, err := depRunnerFrom(cobraCmd.Context()).acquire(cobraCmd.Context())
+				if err != nil {
+					return err
+				}
+				defer release()
+
+				return executor.Execute(cfg, cmd, cobraCmd)
+			}
+
+			// Dependencies inherit --watch but only the invoked command watches
+			if executor.BuiltinBool(cobraCmd, "watch") && !depRunnerFrom(cobraCmd.Context()).watching {
+				return watchCommand(cobraCmd, cfg, cmd, run)
+			}
+
+			return run()
 		},
 	}
 
 	cobraCmd.Flags().BoolP("interactive", "i", false, "Use interactive mode to select options")
 
+	if cmd.Passthrough {
+		// Everything after "--" is handed to the script as .args
+		cobraCmd.Use = cmd.Name + " [flags] -- [args...]"
+		cobraCmd.Args = func(cobraCmd *cobra.Command, args []string) error {
+			beforeDash := cobraCmd.ArgsLenAtDash()
+			if beforeDash < 0 {
+				beforeDash = len(args)
+			}
+			if beforeDash > 0 {
+				return fmt.Errorf("unexpected argument(s) %q: pass extra arguments after \"--\"", args[:beforeDash])
+			}
+			return nil
+		}
+	}
+
 	for _, opt := range cmd.Options {
-		addFlag(cobraCmd, opt)
+		addFlag(cobraCmd, cobraCmd.Flags(), opt)
+		addCompletion(cobraCmd, cfg, opt)
 		// Don't use MarkFlagRequired - we'll validate manually
 	}
 
+	// Global option flags are inherited from the root command. From here on
+	// the command handles them like its own options, from env vars and
+	// prompts to the script template.
+	cmd.Options = cfg.CommandOptions(cmd)
+
+	// Resolve option aliases to their canonical flag
+	if aliases := optionAliases(cmd.Options); len(aliases) > 0 {
+		cobraCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+			if canonical, ok := aliases[name]; ok {
+				return pflag.NormalizedName(canonical)
+			}
+			return pflag.NormalizedName(name)
+		})
+	}
+
 	// Custom flag validation that checks if we're in interactive mode
 	cobraCmd.PreRunE = func(cobraCmd *cobra.Command, args []string) error {
+		// Apply --no-<name> flags before anything else reads the options
+		if err := applyNegations(cobraCmd, cmd.Options); err != nil {
+			return err
+		}
+
+		// Fill options not given on the command line from their env vars
+		if err := applyEnvValues(cobraCmd, cmd.Options); err != nil {
+			return err
+		}
+
 		interactive, _ := cobraCmd.Flags().GetBool("interactive")
 		if !interactive {
 			// Only validate required flags if NOT in interactive mode
 			for _, opt := range cmd.Options {
 				if opt.Mandatory && !cobraCmd.Flags().Changed(opt.Name) {
+					if opt.Env != "" {
+						return fmt.Errorf("required flag(s) \"%s\" not set (or set $%s)", opt.Name, opt.Env)
+					}
 					return fmt.Errorf("required flag(s) \"%s\" not set", opt.Name)
 				}
 			}
+
+			return validateOptionValues(cobraCmd, cfg, cmd)
 		}
 		return nil
 	}
@@ -141,25 +243,74 @@ func buildCommand(cfg *config.Config, cmd config.Command) *cobra.Command {
 	return cobraCmd
 }
 
-func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
+// noChoice is the select entry leaving an optional option unset
+const noChoice = "(none)"
+
+func promptForOptions(cobraCmd *cobra.Command, cfg *config.Config, cmd config.Command) error {
 	for _, opt := range cmd.Options {
 		// Skip if flag was already provided via command line
 		if cobraCmd.Flags().Changed(opt.Name) {
 			continue
 		}
 
+		// Skip options that cannot be combined with what was already chosen
+		if conflictsWithSetOption(cobraCmd, cmd, opt) {
+			continue
+		}
+
+		// Options required by earlier answers must be filled in
+		if isRequiredIf(cobraCmd, opt) {
+			opt.Mandatory = true
+		}
+
 		var prompt survey.Prompt
 		message := opt.Name
 		if opt.Description != "" {
 			message = opt.Description
 		}
 
+		// Offer the declared choices or the live values of the complete command
+		choices := opt.Choices
+		if opt.Complete != "" {
+			var err error
+			choices, err = dynamicChoices(cfg, opt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		if len(choices) > 0 {
+			if !opt.Mandatory {
+				choices = append([]string{noChoice}, choices...)
+			}
+			selectPrompt := &survey.Select{
+				Message: message,
+				Options: choices,
+			}
+			if slices.Contains(choices, opt.Default) {
+				selectPrompt.Default = opt.Default
+			}
+			var answer string
+			if err := survey.AskOne(selectPrompt, &answer); err != nil {
+				return err
+			}
+			if answer != noChoice {
+				if err := cobraCmd.Flags().Set(opt.Name, answer); err != nil {
+					return fmt.Errorf("invalid value %s for option '%s': %w", displayValue(opt, answer), opt.Name, err)
+				}
+			}
+			continue
+		}
+
 		switch opt.Type {
 		case "bool":
+			defaultAnswer := "No"
+			if enabled, _ := strconv.ParseBool(opt.Default); enabled {
+				defaultAnswer = "Yes"
+			}
 			prompt = &survey.Select{
 				Message: message,
 				Options: []string{"Yes", "No"},
-				Default: "No",
+				Default: defaultAnswer,
 			}
 			var answer string
 			if err := survey.AskOne(prompt, &answer); err != nil {
@@ -169,23 +320,55 @@ func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
 			cobraCmd.Flags().Set(opt.Name, strconv.FormatBool(value))
 
 		case "str":
-			prompt = &survey.Input{
-				Message: message,
+			if opt.Secret {
+				prompt = &survey.Password{
+					Message: message,
+				}
+			} else {
+				prompt = &survey.Input{
+					Message: message,
+					Default: opt.Default,
+				}
 			}
 			var answer string
 			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
-				if opt.Mandatory && ans.(string) == "" {
+				str := ans.(string)
+				if opt.Mandatory && str == "" {
 					return fmt.Errorf("this field is required")
 				}
+				if str != "" {
+					return opt.CheckValue(str)
+				}
 				return nil
 			})); err != nil {
 				return err
 			}
 			cobraCmd.Flags().Set(opt.Name, answer)
 
+		case "path", "file", "dir":
+			prompt = &survey.Input{
+				Message: message,
+				Default: opt.Default,
+			}
+			var answer string
+			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
+				str := ans.(string)
+				if opt.Mandatory && str == "" {
+					return fmt.Errorf("this field is required")
+				}
+				return validatePathValue(cfg, opt, str, str != opt.Default)
+			})); err != nil {
+				return err
+			}
+			// An accepted default stays relative to the Kookfile
+			if answer != "" && answer != opt.Default {
+				cobraCmd.Flags().Set(opt.Name, answer)
+			}
+
 		case "int":
 			prompt = &survey.Input{
 				Message: message,
+				Default: opt.Default,
 			}
 			var answer string
 			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
@@ -197,6 +380,56 @@ func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
 					if _, err := strconv.Atoi(str); err != nil {
 						return fmt.Errorf("must be a valid integer")
 					}
+					return opt.CheckValue(str)
+				}
+				return nil
+			})); err != nil {
+				return err
+			}
+			if answer != "" {
+				cobraCmd.Flags().Set(opt.Name, answer)
+			}
+
+		case "duration":
+			prompt = &survey.Input{
+				Message: message,
+				Default: opt.Default,
+			}
+			var answer string
+			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
+				str := ans.(string)
+				if opt.Mandatory && str == "" {
+					return fmt.Errorf("this field is required")
+				}
+				if str != "" {
+					if _, err := time.ParseDuration(str); err != nil {
+						return fmt.Errorf("must be a valid duration (e.g. 30s, 5m, 1h30m)")
+					}
+				}
+				return nil
+			})); err != nil {
+				return err
+			}
+			if answer != "" {
+				cobraCmd.Flags().Set(opt.Name, answer)
+			}
+
+		case "count":
+			prompt = &survey.Input{
+				Message: message,
+				Default: opt.Default,
+			}
+			var answer string
+			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
+				str := ans.(string)
+				if opt.Mandatory && str == "" {
+					return fmt.Errorf("this field is required")
+				}
+				if str != "" {
+					if n, err := strconv.Atoi(str); err != nil || n < 0 {
+						return fmt.Errorf("must be a non-negative integer")
+					}
+					return opt.CheckValue(str)
 				}
 				return nil
 			})); err != nil {
@@ -209,6 +442,7 @@ func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
 		case "float":
 			prompt = &survey.Input{
 				Message: message,
+				Default: opt.Default,
 			}
 			var answer string
 			if err := survey.AskOne(prompt, &answer, survey.WithValidator(func(ans interface{}) error {
@@ -220,6 +454,7 @@ func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
 					if _, err := strconv.ParseFloat(str, 64); err != nil {
 						return fmt.Errorf("must be a valid number")
 					}
+					return opt.CheckValue(str)
 				}
 				return nil
 			})); err != nil {
@@ -234,35 +469,144 @@ func promptForOptions(cobraCmd *cobra.Command, cmd config.Command) error {
 	return nil
 }
 
-func addFlag(cobraCmd *cobra.Command, opt config.Option) {
+// optionAliases maps every option alias, and the negation of aliases of
+// negatable options, to the canonical flag name
+func optionAliases(options []config.Option) map[string]string {
+	aliases := make(map[string]string)
+	for _, opt := range options {
+		for _, alias := range opt.Aliases {
+			aliases[alias] = opt.Name
+			if opt.IsNegatable() {
+				aliases["no-"+alias] = opt.NegationName()
+			}
+		}
+	}
+	return aliases
+}
+
+// applyNegations turns --no-<name> into --<name>=false for negatable options
+func applyNegations(cobraCmd *cobra.Command, options []config.Option) error {
+	for _, opt := range options {
+		if !opt.IsNegatable() || !cobraCmd.Flags().Changed(opt.NegationName()) {
+			continue
+		}
+
+		negated, _ := cobraCmd.Flags().GetBool(opt.NegationName())
+		if cobraCmd.Flags().Changed(opt.Name) {
+			return fmt.Errorf("options '%s' and '%s' cannot be used together", opt.Name, opt.NegationName())
+		}
+
+		cobraCmd.Flags().Set(opt.Name, strconv.FormatBool(!negated))
+	}
+
+	return nil
+}
+
+// applyEnvValues sets options that were not passed as flags from their
+// bound environment variable, giving the precedence flag > env > default.
+// Options set this way count as provided for mandatory checks and prompts.
+func applyEnvValues(cobraCmd *cobra.Command, options []config.Option) error {
+	for _, opt := range options {
+		if opt.Env == "" || cobraCmd.Flags().Changed(opt.Name) {
+			continue
+		}
+
+		value, ok := os.LookupEnv(opt.Env)
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := cobraCmd.Flags().Set(opt.Name, value); err != nil {
+			return fmt.Errorf("invalid value %s for option '%s' from $%s: %w", displayValue(opt, value), opt.Name, opt.Env, err)
+		}
+	}
+
+	return nil
+}
+
+// addCompletion registers value completion for options with choices or a
+// complete command
+func addCompletion(cobraCmd *cobra.Command, cfg *config.Config, opt config.Option) {
+	if len(opt.Choices) > 0 {
+		cobraCmd.RegisterFlagCompletionFunc(opt.Name, cobra.FixedCompletions(opt.Choices, cobra.ShellCompDirectiveNoFileComp))
+	}
+	if opt.Complete != "" {
+		cobraCmd.RegisterFlagCompletionFunc(opt.Name, dynamicCompletion(cfg, opt))
+	}
+}
+
+// addFlag registers the flag for an option in flags, which belong to cobraCmd
+func addFlag(cobraCmd *cobra.Command, flags *pflag.FlagSet, opt config.Option) {
 	usage := opt.Description
+	if len(opt.Aliases) > 0 {
+		usage = strings.TrimSpace(fmt.Sprintf("%s (aliases: --%s)", usage, strings.Join(opt.Aliases, ", --")))
+	}
+	if len(opt.Choices) > 0 {
+		usage = strings.TrimSpace(fmt.Sprintf("%s (one of: %s)", usage, strings.Join(opt.Choices, ", ")))
+	}
+	if opt.Env != "" {
+		usage = strings.TrimSpace(fmt.Sprintf("%s [env: %s]", usage, opt.Env))
+	}
 
+	// Defaults are validated against the option type when loading the Kookfile
 	switch opt.Type {
 	case "bool":
+		defaultValue, _ := strconv.ParseBool(opt.Default)
 		if opt.Shorthand != "" {
-			cobraCmd.Flags().BoolP(opt.Name, opt.Shorthand, false, usage)
+			flags.BoolP(opt.Name, opt.Shorthand, defaultValue, usage)
 		} else {
-			cobraCmd.Flags().Bool(opt.Name, false, usage)
+			flags.Bool(opt.Name, defaultValue, usage)
+		}
+		if opt.IsNegatable() {
+			flags.Bool(opt.NegationName(), false, fmt.Sprintf("Set --%s to false", opt.Name))
 		}
 	case "str":
 		if opt.Shorthand != "" {
-			cobraCmd.Flags().StringP(opt.Name, opt.Shorthand, "", usage)
+			flags.StringP(opt.Name, opt.Shorthand, opt.Default, usage)
 		} else {
-			cobraCmd.Flags().String(opt.Name, "", usage)
+			flags.String(opt.Name, opt.Default, usage)
 		}
+	case "path", "file", "dir":
+		if opt.Shorthand != "" {
+			flags.StringP(opt.Name, opt.Shorthand, opt.Default, usage)
+		} else {
+			flags.String(opt.Name, opt.Default, usage)
+		}
+		cobraCmd.RegisterFlagCompletionFunc(opt.Name, pathCompletion(opt))
 	case "int":
+		defaultValue, _ := strconv.Atoi(opt.Default)
 		if opt.Shorthand != "" {
-			cobraCmd.Flags().IntP(opt.Name, opt.Shorthand, 0, usage)
+			flags.IntP(opt.Name, opt.Shorthand, defaultValue, usage)
 		} else {
-			cobraCmd.Flags().Int(opt.Name, 0, usage)
+			flags.Int(opt.Name, defaultValue, usage)
 		}
 	case "float":
+		defaultValue, _ := strconv.ParseFloat(opt.Default, 64)
+		if opt.Shorthand != "" {
+			flags.Float64P(opt.Name, opt.Shorthand, defaultValue, usage)
+		} else {
+			flags.Float64(opt.Name, defaultValue, usage)
+		}
+	case "count":
 		if opt.Shorthand != "" {
-			cobraCmd.Flags().Float64P(opt.Name, opt.Shorthand, 0.0, usage)
+			flags.CountP(opt.Name, opt.Shorthand, usage)
 		} else {
-			cobraCmd.Flags().Float64(opt.Name, 0.0, usage)
+			flags.Count(opt.Name, usage)
+		}
+		if opt.Default != "" {
+			flag := flags.Lookup(opt.Name)
+			flag.Value.Set(opt.Default)
+			flag.DefValue = opt.Default
 		}
+	case "duration":
+		flags.VarP(&durationValue{raw: opt.Default}, opt.Name, opt.Shorthand, usage)
 	default:
 		fmt.Fprintf(os.Stderr, "Warning: unknown option type '%s' for option '%s'\n", opt.Type, opt.Name)
+		return
+	}
+
+	// Keep secret defaults out of --help
+	if opt.Secret {
+		flags.Lookup(opt.Name).DefValue = ""
 	}
 }
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// runKook runs a command line against a Kookfile like kook does, and returns
+// what the command wrote
+func runKook(t *testing.T, kookfile string, args ...string) (string, error) {
+	cfg, _ := loadDepsConfig(t, kookfile)
+
+	root := &cobra.Command{Use: "kook", SilenceErrors: true, SilenceUsage: true}
+	addBuiltinFlags(root)
+	addGlobalFlags(root, cfg)
+	for _, cmd := range cfg.Commands {
+		root.AddCommand(buildCommand(cfg, cmd))
+	}
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetIn(strings.NewReader(""))
+	root.SetArgs(args)
+
+	err := root.ExecuteContext(withDepRunner(context.Background()))
+	return out.String(), err
+}
+
+// Test that options take their value from the flag, else their env var,
+// else their default
+func TestOptionEnvValues(t *testing.T) {
+	kookfile := `
+version: 1
+shell: builtin
+commands:
+  - name: deploy
+    silent: true
+    options:
+      - name: stage
+        type: str
+        env: KOOK_TEST_STAGE
+        default: staging
+      - name: token
+        type: str
+        env: KOOK_TEST_TOKEN
+        mandatory: true
+    script: echo "{{ .stage }} {{ .token }}"
+`
+	t.Setenv("KOOK_TEST_TOKEN", "abc")
+
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		expected string
+	}{
+		{"default", "", nil, "staging abc\n"},
+		{"env over default", "prod", nil, "prod abc\n"},
+		{"flag over env", "prod", []string{"--stage", "dev"}, "dev abc\n"},
+		{"flag over mandatory env", "", []string{"--token", "xyz"}, "staging xyz\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KOOK_TEST_STAGE", tt.env)
+			out, err := runKook(t, kookfile, append([]string{"deploy"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if out != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+
+	// Without its env var, the mandatory option must be passed
+	t.Setenv("KOOK_TEST_TOKEN", "")
+	_, err := runKook(t, kookfile, "deploy")
+	if err == nil || !strings.Contains(err.Error(), "$KOOK_TEST_TOKEN") {
+		t.Errorf("Expected the missing mandatory option to mention its env var, got %v", err)
+	}
+}
@@ -2,6 +2,9 @@ package cli
 
 import (
 	"os"
+	"strings"
+
+	"kook/internal/config"
 
 	"github.com/spf13/cobra"
 )
@@ -56,3 +59,23 @@ PowerShell:
 		},
 	}
 }
+
+// pathCompletion completes path options with the shell's file completion,
+// restricted to directories or to the option's extensions when set
+func pathCompletion(opt config.Option) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if opt.Type == "dir" {
+			return nil, cobra.ShellCompDirectiveFilterDirs
+		}
+
+		if len(opt.Extensions) > 0 {
+			extensions := make([]string, len(opt.Extensions))
+			for i, ext := range opt.Extensions {
+				extensions[i] = strings.TrimPrefix(ext, ".")
+			}
+			return extensions, cobra.ShellCompDirectiveFilterFileExt
+		}
+
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+}
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"kook/internal/config"
+	"kook/internal/executor"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type depRunnerKey struct{}
+
+// depRunner coordinates the dependencies run during one invocation: each
+// runs at most once, and at most jobs scripts run at the same time
+type depRunner struct {
+	jobs      int
+	keepGoing bool
+	slots     chan struct{}
+
+	// watching is set for runs started by a watch loop
+	watching bool
+
+	mu   sync.Mutex
+	runs map[string]*depRun
+}
+
+// depRun is a dependency started during this invocation
+type depRun struct {
+	done chan struct{}
+	err  error
+}
+
+func withDepRunner(ctx context.Context) context.Context {
+	return context.WithValue(ctx, depRunnerKey{}, newDepRunner(1, false))
+}
+
+func newDepRunner(jobs int, keepGoing bool) *depRunner {
+	return &depRunner{
+		jobs:      jobs,
+		keepGoing: keepGoing,
+		slots:     make(chan struct{}, jobs),
+		runs:      make(map[string]*depRun),
+	}
+}
+
+func depRunnerFrom(ctx context.Context) *depRunner {
+	if runner, ok := ctx.Value(depRunnerKey{}).(*depRunner); ok {
+		return runner
+	}
+	return newDepRunner(1, false)
+}
+
+// configure applies the --jobs and --keep-going flags, before any dependency runs
+func (r *depRunner) configure(jobs int, keepGoing bool) error {
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	r.jobs = jobs
+	r.keepGoing = keepGoing
+	r.slots = make(chan struct{}, jobs)
+	return nil
+}
+
+// acquire waits for a free job slot and returns the function releasing it
+func (r *depRunner) acquire(ctx context.Context) (func(), error) {
+	select {
+	case r.slots <- struct{}{}:
+		return func() { <-r.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// once runs fn for the first caller with a given key. Later callers wait for
+// that run and share its result.
+func (r *depRunner) once(key string, fn func() error) error {
+	r.mu.Lock()
+	if run, ok := r.runs[key]; ok {
+		r.mu.Unlock()
+		<-run.done
+		return run.err
+	}
+	run := &depRun{done: make(chan struct{})}
+	r.runs[key] = run
+	r.mu.Unlock()
+
+	run.err = fn()
+	close(run.done)
+	return run.err
+}
+
+// runDeps runs the dependencies of a command, skipping those already run
+// during this invocation. With --jobs 1 they run in order; otherwise they
+// run concurrently and their output is prefixed with the command name.
+func runDeps(cobraCmd *cobra.Command, cfg *config.Config, cmd config.Command) error {
+	if len(cmd.Deps) == 0 {
+		return nil
+	}
+
+	runner := depRunnerFrom(cobraCmd.Context())
+	parallel := runner.jobs > 1 && len(cmd.Deps) > 1
+
+	// Fail fast: the first failure cancels the dependencies still running
+	ctx, cancel := context.WithCancel(cobraCmd.Context())
+	defer cancel()
+
+	errs := make([]error, len(cmd.Deps))
+	var wg sync.WaitGroup
+
+	for i, dep := range cmd.Deps {
+		name, args, err := config.ParseDep(dep)
+		if err != nil {
+			return err
+		}
+
+		depCmd, ok := cfg.FindCommand(name)
+		if !ok {
+			return fmt.Errorf("unknown command '%s' in dependency '%s'", name, dep)
+		}
+
+		key := strings.TrimSpace(depCmd.Name + " " + shellquote.Join(args...))
+		run := func() error {
+			err := runner.once(key, func() error {
+				return runDep(ctx, cobraCmd, cfg, depCmd, args, runner.jobs > 1)
+			})
+			if err != nil {
+				err = fmt.Errorf("dependency '%s' failed: %w", dep, err)
+				if !runner.keepGoing {
+					cancel()
+				}
+			}
+			return err
+		}
+
+		if !parallel {
+			if errs[i] = run(); errs[i] != nil && !runner.keepGoing {
+				break
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = run()
+		}(i)
+	}
+	wg.Wait()
+
+	if runner.keepGoing {
+		return errors.Join(errs...)
+	}
+
+	// Report the failure that stopped the run rather than the cancellations
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// runDep runs a dependency through its own command tree, so its flags are
+// parsed and checked like on the command line. Built-in flags and global
+// options given to the invoking command carry over, and the dependency
+// arguments can override them.
+func runDep(ctx context.Context, parent *cobra.Command, cfg *config.Config, depCmd config.Command, args []string, prefixed bool) error {
+	root := &cobra.Command{
+		Use:           "kook",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	addBuiltinFlags(root)
+	addGlobalFlags(root, cfg)
+
+	// Options of the invoking command with the name of a built-in flag are
+	// its own and do not carry over
+	flags := root.PersistentFlags()
+	var setErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		parentFlag := executor.BuiltinFlag(parent, flag.Name)
+		if setErr == nil && parentFlag != nil && parentFlag.Changed {
+			setErr = flags.Set(flag.Name, parentFlag.Value.String())
+		}
+	})
+	if setErr != nil {
+		return setErr
+	}
+
+	// Concurrent dependencies get labelled output and no terminal input
+	if prefixed {
+		stdout := newPrefixWriter(depCmd.Name, parent.OutOrStdout())
+		stderr := newPrefixWriter(depCmd.Name, parent.ErrOrStderr())
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		root.SetOut(stdout)
+		root.SetErr(stderr)
+		root.SetIn(bytes.NewReader(nil))
+	}
+
+	root.AddCommand(buildCommand(cfg, depCmd))
+	root.SetArgs(append([]string{depCmd.Name}, args...))
+
+	return root.ExecuteContext(ctx)
+}
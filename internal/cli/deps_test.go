@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// loadDepsConfig loads a Kookfile whose scripts log their runs to a file
+func loadDepsConfig(t *testing.T, kookfile string) (*config.Config, string) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, config.ConfigFileName)
+	if err := os.WriteFile(path, []byte(kookfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return cfg, filepath.Join(dir, "log")
+}
+
+// runCommandDeps runs the dependencies of a command with a fresh runner
+func runCommandDeps(t *testing.T, cfg *config.Config, name string, jobs int, keepGoing bool) error {
+	cmd, ok := cfg.FindCommand(name)
+	if !ok {
+		t.Fatalf("Unknown command %s", name)
+	}
+
+	// Like on the command line, the invoking command has parsed its flags
+	cobraCmd := &cobra.Command{}
+	addBuiltinFlags(cobraCmd)
+	if err := cobraCmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	cobraCmd.SetOut(&bytes.Buffer{})
+	cobraCmd.SetErr(&bytes.Buffer{})
+	cobraCmd.SetContext(context.WithValue(context.Background(), depRunnerKey{}, newDepRunner(jobs, keepGoing)))
+
+	return runDeps(cobraCmd, cfg, cmd)
+}
+
+func readLog(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+// Test that concurrent callers with the same key share one run
+func TestDepRunnerOnce(t *testing.T) {
+	runner := newDepRunner(4, false)
+	var calls atomic.Int32
+	failure := errors.New("failed")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = runner.once("build", func() error {
+				calls.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return failure
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected one run, got %d", calls.Load())
+	}
+	for _, err := range errs {
+		if err != failure {
+			t.Errorf("Expected every caller to get the shared result, got %v", err)
+		}
+	}
+
+	runner.once("test", func() error { calls.Add(1); return nil })
+	if calls.Load() != 2 {
+		t.Error("Expected a different key to run")
+	}
+}
+
+const depsKookfile = `
+version: 1
+shell: builtin
+commands:
+  - name: gen
+    script: echo gen >> "{{ .kookfile_dir }}/log"
+  - name: build
+    deps: [gen]
+    script: echo build >> "{{ .kookfile_dir }}/log"
+  - name: all
+    deps: [build, gen]
+    script: echo all
+  - name: slow
+    script: sleep 5; echo slow >> "{{ .kookfile_dir }}/log"
+  - name: fail
+    script: exit 1
+  - name: fail2
+    script: exit 2
+  - name: fast-fail
+    deps: [slow, fail]
+    script: echo never
+  - name: many-fail
+    deps: [fail, gen, fail2]
+    script: echo never
+`
+
+// Test that a dependency shared by several commands runs once
+func TestRunDepsOnce(t *testing.T) {
+	for _, jobs := range []int{1, 2} {
+		cfg, log := loadDepsConfig(t, depsKookfile)
+		if err := runCommandDeps(t, cfg, "all", jobs, false); err != nil {
+			t.Fatalf("Unexpected error with %d jobs: %v", jobs, err)
+		}
+
+		runs := readLog(t, log)
+		if len(runs) != 2 || runs[0] != "gen" || runs[1] != "build" {
+			t.Errorf("Expected gen then build once with %d jobs, got %v", jobs, runs)
+		}
+	}
+}
+
+// Test that the first failure stops the dependencies still running and is
+// the one reported
+func TestRunDepsFailFast(t *testing.T) {
+	cfg, log := loadDepsConfig(t, depsKookfile)
+
+	start := time.Now()
+	err := runCommandDeps(t, cfg, "fast-fail", 2, false)
+	if err == nil || !strings.Contains(err.Error(), "dependency 'fail' failed") {
+		t.Fatalf("Expected the failing dependency to be reported, got %v", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the failure rather than the cancellation, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Expected the slow dependency to be stopped, took %s", elapsed)
+	}
+	if runs := readLog(t, log); len(runs) != 0 {
+		t.Errorf("Expected the slow dependency not to finish, got %v", runs)
+	}
+}
+
+// Test that --keep-going runs the other dependencies and reports every failure
+func TestRunDepsKeepGoing(t *testing.T) {
+	for _, jobs := range []int{1, 2} {
+		cfg, log := loadDepsConfig(t, depsKookfile)
+
+		err := runCommandDeps(t, cfg, "many-fail", jobs, true)
+		if err == nil || !strings.Contains(err.Error(), "dependency 'fail' failed") || !strings.Contains(err.Error(), "dependency 'fail2' failed") {
+			t.Errorf("Expected both failures with %d jobs, got %v", jobs, err)
+		}
+		if runs := readLog(t, log); len(runs) != 1 || runs[0] != "gen" {
+			t.Errorf("Expected gen to run with %d jobs, got %v", jobs, runs)
+		}
+	}
+
+	cfg, log := loadDepsConfig(t, depsKookfile)
+	if err := runCommandDeps(t, cfg, "many-fail", 1, false); err == nil || strings.Contains(err.Error(), "fail2") {
+		t.Errorf("Expected only the first failure without keep-going, got %v", err)
+	}
+	if runs := readLog(t, log); len(runs) != 0 {
+		t.Errorf("Expected no dependency after the failure, got %v", runs)
+	}
+}
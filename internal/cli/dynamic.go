@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kook/internal/config"
+	"kook/internal/executor"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultCompleteTimeout = 5 * time.Second
+	completeCacheTTL       = 10 * time.Second
+)
+
+// dynamicCompletion completes an option with the output lines of its
+// complete command
+func dynamicCompletion(cfg *config.Config, opt config.Option) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		choices, err := dynamicChoices(cfg, opt)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return choices, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// dynamicChoices runs the option's complete command with the top-level shell
+// from the Kookfile directory and returns its non-empty output lines. Results are cached for
+// a few seconds so repeated completions stay fast.
+func dynamicChoices(cfg *config.Config, opt config.Option) ([]string, error) {
+	cachePath := completeCachePath(cfg, opt)
+	if cachePath != "" {
+		if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < completeCacheTTL {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				return splitLines(string(data)), nil
+			}
+		}
+	}
+
+	timeout := defaultCompleteTimeout
+	if opt.CompleteTimeout != "" {
+		timeout, _ = time.ParseDuration(opt.CompleteTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := executor.Output(ctx, cfg.HostShell(), cfg.Dir, opt.Complete)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("complete command for option '%s' timed out after %s", opt.Name, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("complete command for option '%s' failed: %w", opt.Name, err)
+	}
+
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err == nil {
+			os.WriteFile(cachePath, output, 0o600)
+		}
+	}
+
+	return splitLines(string(output)), nil
+}
+
+// completeCachePath returns the cache file for an option's complete command,
+// or an empty string when no cache directory is available
+func completeCachePath(cfg *config.Config, opt config.Option) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(cfg.Dir + "\x00" + opt.Complete))
+	return filepath.Join(cacheDir, "kook", "complete", hex.EncodeToString(sum[:]))
+}
+
+func splitLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that complete commands run with the top-level shell, so the builtin
+// shell works without bash
+func TestDynamicChoicesShell(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cfg, _ := loadDepsConfig(t, `version: 1
+shell: builtin
+commands:
+  - name: deploy
+    options:
+      - name: env
+        type: str
+        complete: 'for env in dev prod; do echo "$env"; done'
+    script: "true"
+`)
+	t.Setenv("PATH", "")
+
+	cmd, _ := cfg.FindCommand("deploy")
+	choices, err := dynamicChoices(cfg, cmd.Options[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(choices, ",") != "dev,prod" {
+		t.Errorf("Expected dev,prod, got %v", choices)
+	}
+}
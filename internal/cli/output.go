@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// outputMu keeps lines written by concurrent commands from interleaving
+var outputMu sync.Mutex
+
+// prefixWriter labels each line written to it with a command name
+type prefixWriter struct {
+	prefix []byte
+	out    io.Writer
+	buf    []byte
+}
+
+// newPrefixWriter labels lines with name. Writers wrapping another
+// prefixWriter write to its destination directly, so nested dependencies
+// carry their own label only.
+func newPrefixWriter(name string, out io.Writer) *prefixWriter {
+	if inner, ok := out.(*prefixWriter); ok {
+		out = inner.out
+	}
+	return &prefixWriter{prefix: []byte("[" + name + "] "), out: out}
+}
+
+// Write outputs every complete line and keeps the rest until the next write
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush outputs a trailing line without a newline
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	if _, err := w.out.Write(w.prefix); err != nil {
+		return err
+	}
+	_, err := w.out.Write(line)
+	return err
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test that complete lines are labelled and partial lines kept for later
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := newPrefixWriter("build", &out)
+
+	w.Write([]byte("compiling"))
+	if out.Len() != 0 {
+		t.Errorf("Expected partial line to be kept, got %q", out.String())
+	}
+
+	w.Write([]byte(" main.go\nlinking\ndone"))
+	if expected := "[build] compiling main.go\n[build] linking\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[build] compiling main.go\n[build] linking\n[build] done\n"; out.String() != expected {
+		t.Errorf("Expected flush to end the last line, got %q", out.String())
+	}
+
+	out.Reset()
+	w.Flush()
+	if out.Len() != 0 {
+		t.Errorf("Expected flush without buffered output to write nothing, got %q", out.String())
+	}
+}
+
+// Test that nested dependencies carry their own label only
+func TestNestedPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	outer := newPrefixWriter("all", &out)
+	inner := newPrefixWriter("lint", outer)
+
+	inner.Write([]byte("ok\n"))
+	outer.Write([]byte("done\n"))
+
+	if expected := "[lint] ok\n[all] done\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
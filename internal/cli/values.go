@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// validateOptionValues checks the values of all provided options against
+// the constraints declared in the Kookfile
+func validateOptionValues(cobraCmd *cobra.Command, cfg *config.Config, cmd config.Command) error {
+	for _, opt := range cmd.Options {
+		// Path defaults are checked too, unset options are empty
+		if opt.IsPathType() {
+			value, _ := cobraCmd.Flags().GetString(opt.Name)
+			if err := validatePathValue(cfg, opt, value, cobraCmd.Flags().Changed(opt.Name)); err != nil {
+				return fmt.Errorf("invalid value for option '%s': %w", opt.Name, err)
+			}
+		}
+
+		// Defaults are checked against choices, pattern and bounds at load time
+		if cobraCmd.Flags().Changed(opt.Name) {
+			value := cobraCmd.Flags().Lookup(opt.Name).Value.String()
+			if err := opt.CheckValue(value); err != nil {
+				return fmt.Errorf("invalid value %s for option '%s': %w", displayValue(opt, value), opt.Name, err)
+			}
+		}
+	}
+
+	return validateOptionRelations(cobraCmd, cmd)
+}
+
+// validateOptionRelations enforces conflicts_with, requires and required_if
+func validateOptionRelations(cobraCmd *cobra.Command, cmd config.Command) error {
+	for _, opt := range cmd.Options {
+		if isRequiredIf(cobraCmd, opt) && !isOptionSet(cobraCmd, opt.Name) {
+			return fmt.Errorf("option '%s' is required when %s", opt.Name, describeConditions(opt.RequiredIf))
+		}
+
+		if !isOptionSet(cobraCmd, opt.Name) {
+			continue
+		}
+
+		for _, other := range opt.ConflictsWith {
+			if isOptionSet(cobraCmd, other) {
+				return fmt.Errorf("option '%s' cannot be used with '%s'", opt.Name, other)
+			}
+		}
+
+		for _, other := range opt.Requires {
+			if !isOptionSet(cobraCmd, other) {
+				return fmt.Errorf("option '%s' requires '%s'", opt.Name, other)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isOptionSet reports whether an option was provided. A bool option only
+// counts as provided when it is true, so --all=false does not conflict.
+func isOptionSet(cobraCmd *cobra.Command, name string) bool {
+	flag := cobraCmd.Flags().Lookup(name)
+	if flag == nil || !flag.Changed {
+		return false
+	}
+	if flag.Value.Type() == "bool" {
+		return flag.Value.String() == "true"
+	}
+	return true
+}
+
+// isRequiredIf reports whether all required_if conditions of an option match
+// the current option values
+func isRequiredIf(cobraCmd *cobra.Command, opt config.Option) bool {
+	if len(opt.RequiredIf) == 0 {
+		return false
+	}
+
+	for name, expected := range opt.RequiredIf {
+		flag := cobraCmd.Flags().Lookup(name)
+		if flag == nil || flag.Value.String() != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// conflictsWithSetOption reports whether an option conflicts, in either
+// direction, with an option that was already provided
+func conflictsWithSetOption(cobraCmd *cobra.Command, cmd config.Command, opt config.Option) bool {
+	for _, other := range opt.ConflictsWith {
+		if isOptionSet(cobraCmd, other) {
+			return true
+		}
+	}
+
+	for _, other := range cmd.Options {
+		if !isOptionSet(cobraCmd, other.Name) {
+			continue
+		}
+		for _, name := range other.ConflictsWith {
+			if name == opt.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// displayValue quotes a value for error messages, masking secret values
+func displayValue(opt config.Option, value string) string {
+	if opt.Secret {
+		return "****"
+	}
+	return strconv.Quote(value)
+}
+
+func describeConditions(conditions map[string]string) string {
+	names := make([]string, 0, len(conditions))
+	for name := range conditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("'%s' is '%s'", name, conditions[name])
+	}
+	return strings.Join(parts, " and ")
+}
+
+// validatePathValue checks a path option value against its type and its
+// must_exist and extensions constraints. given reports whether the value
+// comes from the user rather than the option default.
+func validatePathValue(cfg *config.Config, opt config.Option, value string, given bool) error {
+	if value == "" {
+		return nil
+	}
+
+	path := cfg.ResolveOptionPath(value, given)
+
+	if len(opt.Extensions) > 0 && !hasExtension(path, opt.Extensions) {
+		return fmt.Errorf("'%s' must have one of the extensions: %s", value, strings.Join(opt.Extensions, ", "))
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if opt.MustExist {
+			return fmt.Errorf("'%s' does not exist", value)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch opt.Type {
+	case "file":
+		if info.IsDir() {
+			return fmt.Errorf("'%s' is a directory, expected a file", value)
+		}
+	case "dir":
+		if !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", value)
+		}
+	}
+
+	return nil
+}
+
+func hasExtension(path string, extensions []string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// durationValue is a flag value accepting Go duration syntax (30s, 5m, 1h30m).
+// It keeps the value as written so templates can render it unchanged.
+type durationValue struct {
+	raw string
+}
+
+func (d *durationValue) Set(value string) error {
+	if _, err := time.ParseDuration(value); err != nil {
+		return fmt.Errorf("must be a valid duration (e.g. 30s, 5m, 1h30m)")
+	}
+	d.raw = value
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return d.raw
+}
+
+func (d *durationValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+const relationsKookfile = `
+version: 1
+shell: builtin
+commands:
+  - name: deploy
+    silent: true
+    options:
+      - name: all
+        type: bool
+        conflicts_with: [service]
+      - name: service
+        type: str
+      - name: push
+        type: bool
+        requires: [registry]
+      - name: registry
+        type: str
+      - name: env
+        type: str
+        default: dev
+      - name: approver
+        type: str
+        required_if: {env: prod}
+    script: echo ok
+`
+
+// Test that option relationships are enforced on the command line
+func TestOptionRelations(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{"no options", nil, ""},
+		{"conflict", []string{"--all", "--service", "api"}, "option 'all' cannot be used with 'service'"},
+		{"false bool does not conflict", []string{"--all=false", "--service", "api"}, ""},
+		{"requires missing", []string{"--push"}, "option 'push' requires 'registry'"},
+		{"requires given", []string{"--push", "--registry", "ghcr.io"}, ""},
+		{"false bool does not require", []string{"--push=false"}, ""},
+		{"required if matching", []string{"--env", "prod"}, "option 'approver' is required when 'env' is 'prod'"},
+		{"required if given", []string{"--env", "prod", "--approver", "alice"}, ""},
+		{"required if not matching", []string{"--env", "staging"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runKook(t, relationsKookfile, append([]string{"deploy"}, tt.args...)...)
+			if tt.error == "" && err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+			if tt.error != "" && (err == nil || !strings.Contains(err.Error(), tt.error)) {
+				t.Errorf("Expected error %q, got: %v", tt.error, err)
+			}
+		})
+	}
+}
+
+// Test that invalid secret values are not echoed in errors
+func TestSecretValueErrors(t *testing.T) {
+	kookfile := `
+version: 1
+shell: builtin
+commands:
+  - name: login
+    silent: true
+    options:
+      - name: pw
+        type: str
+        secret: true
+        pattern: "^[a-z]+$"
+      - name: user
+        type: str
+        pattern: "^[a-z]+$"
+    script: echo ok
+`
+	_, err := runKook(t, kookfile, "login", "--pw", "Secret123")
+	if err == nil || strings.Contains(err.Error(), "Secret123") || !strings.Contains(err.Error(), "invalid value **** for option 'pw'") {
+		t.Errorf("Expected the secret to be masked, got: %v", err)
+	}
+
+	_, err = runKook(t, kookfile, "login", "--user", "Alice")
+	if err == nil || !strings.Contains(err.Error(), `invalid value "Alice" for option 'user'`) {
+		t.Errorf("Expected the value in the error, got: %v", err)
+	}
+}
+
+// Test the options skipped in prompts because of an option already given
+func TestConflictsWithSetOption(t *testing.T) {
+	cfg, _ := loadDepsConfig(t, relationsKookfile)
+	cmd, _ := cfg.FindCommand("deploy")
+
+	parse := func(args ...string) *cobra.Command {
+		cobraCmd := buildCommand(cfg, cmd)
+		if err := cobraCmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		return cobraCmd
+	}
+	option := func(name string) config.Option {
+		for _, opt := range cmd.Options {
+			if opt.Name == name {
+				return opt
+			}
+		}
+		t.Fatalf("Unknown option %s", name)
+		return config.Option{}
+	}
+
+	// Conflicts count in both directions
+	if !conflictsWithSetOption(parse("--service", "api"), cmd, option("all")) {
+		t.Error("Expected all to conflict with a given service")
+	}
+	if !conflictsWithSetOption(parse("--all"), cmd, option("service")) {
+		t.Error("Expected service to conflict with a given all")
+	}
+	if conflictsWithSetOption(parse("--all=false"), cmd, option("service")) {
+		t.Error("Expected a false bool not to conflict")
+	}
+	if conflictsWithSetOption(parse("--registry", "ghcr.io"), cmd, option("push")) {
+		t.Error("Expected unrelated options not to conflict")
+	}
+}
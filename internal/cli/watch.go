@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchDebounce is how long file events must settle before a restart, so a
+// burst of writes (a save, a checkout) restarts the command once
+const watchDebounce = 200 * time.Millisecond
+
+// ignoredWatchDirs are never watched: version control and kook's own state
+var ignoredWatchDirs = map[string]bool{".git": true, ".kook": true}
+
+// watchCommand runs a command and runs it again whenever a file matching its
+// watch patterns (or its sources) changes, stopping the previous run first.
+// It returns when kook is interrupted.
+func watchCommand(cobraCmd *cobra.Command, cfg *config.Config, cmd config.Command, run func() error) error {
+	patterns := cmd.Watch
+	if len(patterns) == 0 {
+		patterns = cmd.Sources
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("command '%s' has no watch or sources patterns", cmd.Name)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+
+	fw := &fileWatcher{watcher: watcher, cfg: cfg, patterns: patterns}
+	if err := fw.addPatterns(); err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+
+	// Scripts run in their own process group and do not receive Ctrl-C, so
+	// stop them on interrupt before exiting
+	ctx, stop := signal.NotifyContext(cobraCmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	changes := make(chan string, 1)
+	go fw.debounce(ctx, changes)
+
+	stderr := cobraCmd.ErrOrStderr()
+	runner := depRunnerFrom(ctx)
+
+	for {
+		// Each run starts afresh, dependencies included
+		runCtx, cancel := context.WithCancel(ctx)
+		runRunner := newDepRunner(runner.jobs, runner.keepGoing)
+		runRunner.watching = true
+		runCtx = context.WithValue(runCtx, depRunnerKey{}, runRunner)
+		cobraCmd.SetContext(runCtx)
+
+		done := make(chan error, 1)
+		go func(done chan<- error) { done <- run() }(done)
+
+		var changed string
+		for changed == "" {
+			select {
+			case <-ctx.Done():
+				cancel()
+				if done != nil {
+					<-done
+				}
+				return nil
+			case err := <-done:
+				done = nil
+				if err != nil && !errors.Is(err, context.Canceled) {
+					fmt.Fprintf(stderr, "Error: %v\n", err)
+				}
+				fmt.Fprintf(stderr, "Watching for changes...\n")
+			case changed = <-changes:
+			}
+		}
+
+		cancel()
+		if done != nil {
+			<-done
+		}
+		fmt.Fprintf(stderr, "%s changed, restarting %s\n", changed, cmd.Name)
+	}
+}
+
+// fileWatcher watches the directories that can hold files matching a
+// command's patterns
+type fileWatcher struct {
+	watcher  *fsnotify.Watcher
+	cfg      *config.Config
+	patterns []string
+
+	// recursive holds the directories watched with all their subdirectories
+	recursive []string
+}
+
+// addPatterns watches the fixed directory of each pattern, with its
+// subdirectories when the pattern can match files below it
+func (w *fileWatcher) addPatterns() error {
+	for _, pattern := range w.patterns {
+		base, rest := doublestar.SplitPattern(filepath.ToSlash(pattern))
+		dir := w.cfg.ResolvePath(filepath.FromSlash(base))
+
+		if strings.Contains(rest, "/") || strings.Contains(rest, "**") {
+			w.recursive = append(w.recursive, dir)
+			if err := w.addTree(dir); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := w.watcher.Add(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTree watches dir and all its subdirectories
+func (w *fileWatcher) addTree(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && ignoredWatchDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+	return err
+}
+
+// debounce sends the first file changed in each burst of events once the
+// events have settled
+func (w *fileWatcher) debounce(ctx context.Context, changes chan<- string) {
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	var changed string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				w.addCreatedDir(event.Name)
+			}
+			if event.Op == fsnotify.Chmod || !w.matches(event.Name) {
+				continue
+			}
+			if changed == "" {
+				changed = event.Name
+			}
+			timer.Reset(watchDebounce)
+		case <-w.watcher.Errors:
+		case <-timer.C:
+			rel, err := filepath.Rel(w.cfg.Dir, changed)
+			if err != nil {
+				rel = changed
+			}
+			select {
+			case changes <- rel:
+			default:
+			}
+			changed = ""
+		}
+	}
+}
+
+// addCreatedDir watches a new directory inside a recursively watched one
+func (w *fileWatcher) addCreatedDir(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() || ignoredWatchDirs[info.Name()] {
+		return
+	}
+	for _, dir := range w.recursive {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			w.addTree(path)
+			return
+		}
+	}
+}
+
+func (w *fileWatcher) matches(path string) bool {
+	for _, pattern := range w.patterns {
+		if ok, _ := doublestar.PathMatch(w.cfg.ResolvePath(pattern), path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestWatcher watches patterns in a project with a few directories
+func newTestWatcher(t *testing.T, patterns ...string) *fileWatcher {
+	dir := t.TempDir()
+	for _, sub := range []string{"src/api/v1", "src/.git", "templates/partials", "docs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+
+	fw := &fileWatcher{watcher: watcher, cfg: &config.Config{Dir: dir}, patterns: patterns}
+	if err := fw.addPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	return fw
+}
+
+func watchedDirs(fw *fileWatcher) []string {
+	var dirs []string
+	for _, path := range fw.watcher.WatchList() {
+		rel, _ := filepath.Rel(fw.cfg.Dir, path)
+		dirs = append(dirs, filepath.ToSlash(rel))
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+// Test that patterns watch their fixed directory, recursively when they can
+// match below it
+func TestWatchPatterns(t *testing.T) {
+	fw := newTestWatcher(t, "src/**/*.go", "templates/*.html", "go.mod", "missing/*.txt")
+
+	expected := []string{".", "src", "src/api", "src/api/v1", "templates"}
+	if dirs := watchedDirs(fw); !slices.Equal(dirs, expected) {
+		t.Errorf("Expected watched directories %v, got %v", expected, dirs)
+	}
+	if len(fw.recursive) != 1 || fw.recursive[0] != filepath.Join(fw.cfg.Dir, "src") {
+		t.Errorf("Expected src to be watched recursively, got %v", fw.recursive)
+	}
+}
+
+// Test which changed files restart the command
+func TestWatchMatches(t *testing.T) {
+	fw := newTestWatcher(t, "src/**/*.go", "templates/*.html")
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"src/main.go", true},
+		{"src/api/v1/handler.go", true},
+		{"src/README.md", false},
+		{"templates/index.html", true},
+		{"templates/partials/nav.html", false},
+		{"main.go", false},
+	}
+
+	for _, tt := range tests {
+		if actual := fw.matches(filepath.Join(fw.cfg.Dir, tt.path)); actual != tt.expected {
+			t.Errorf("matches(%s) = %v, expected %v", tt.path, actual, tt.expected)
+		}
+	}
+}
+
+// Test that directories created in recursively watched ones are watched
+func TestWatchCreatedDirs(t *testing.T) {
+	fw := newTestWatcher(t, "src/**/*.go", "templates/*.html")
+
+	for _, sub := range []string{"src/api/v2/internal", "src/.kook", "templates/layouts"} {
+		path := filepath.Join(fw.cfg.Dir, sub)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		fw.addCreatedDir(filepath.Join(fw.cfg.Dir, filepath.Dir(sub)))
+		fw.addCreatedDir(path)
+	}
+
+	dirs := watchedDirs(fw)
+	for _, dir := range []string{"src/api/v2", "src/api/v2/internal"} {
+		if !slices.Contains(dirs, dir) {
+			t.Errorf("Expected %s to be watched, got %v", dir, dirs)
+		}
+	}
+	for _, dir := range []string{"src/.kook", "templates/layouts"} {
+		if slices.Contains(dirs, dir) {
+			t.Errorf("Expected %s not to be watched, got %v", dir, dirs)
+		}
+	}
+}
+
+// Test that a burst of changes is reported once, and other files ignored
+func TestWatchDebounce(t *testing.T) {
+	fw := newTestWatcher(t, "src/**/*.go")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 1)
+	go fw.debounce(ctx, changes)
+
+	write := func(path string) {
+		if err := os.WriteFile(filepath.Join(fw.cfg.Dir, path), []byte(time.Now().String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("src/README.md")
+	select {
+	case changed := <-changes:
+		t.Fatalf("Expected no change for an unwatched file, got %s", changed)
+	case <-time.After(2 * watchDebounce):
+	}
+
+	for i := 0; i < 5; i++ {
+		write("src/api/main.go")
+		write("src/api/v1/handler.go")
+		time.Sleep(watchDebounce / 10)
+	}
+
+	select {
+	case changed := <-changes:
+		if changed != filepath.Join("src", "api", "main.go") {
+			t.Errorf("Expected the first changed file, got %s", changed)
+		}
+	case <-time.After(10 * watchDebounce):
+		t.Fatal("Expected a change")
+	}
+
+	select {
+	case changed := <-changes:
+		t.Errorf("Expected a single change for the burst, got another for %s", changed)
+	case <-time.After(2 * watchDebounce):
+	}
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Test valid configurations
@@ -61,6 +66,21 @@ func TestLoadInvalidConfigs(t *testing.T) {
 			filename:    "testdata/invalid/invalid_shorthand.yaml",
 			expectError: "shorthand",
 		},
+		{
+			name:        "Unknown option reference",
+			filename:    "testdata/invalid/unknown_option_reference.yaml",
+			expectError: "unknown option",
+		},
+		{
+			name:        "Invalid type base",
+			filename:    "testdata/invalid/invalid_type_base.yaml",
+			expectError: "base type",
+		},
+		{
+			name:        "Dependency cycle",
+			filename:    "testdata/invalid/dependency_cycle.yaml",
+			expectError: "cycle",
+		},
 		{
 			name:        "Empty file",
 			filename:    "testdata/invalid/empty_file.yaml",
@@ -156,3 +176,147 @@ func TestMissingScript(t *testing.T) {
 		t.Error("Expected error for missing script")
 	}
 }
+
+// Test that paths are resolved relative to the Kookfile
+func TestResolvePath(t *testing.T) {
+	config, err := Load("testdata/valid/minimal.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expectedDir, _ := filepath.Abs("testdata/valid")
+	if config.Dir != expectedDir {
+		t.Errorf("Expected Dir = %s, got: %s", expectedDir, config.Dir)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", ""},
+		{"dumps/latest.sql", filepath.Join(expectedDir, "dumps/latest.sql")},
+		{"./dumps/../dumps/latest.sql", filepath.Join(expectedDir, "dumps/latest.sql")},
+		{"/var/backups//latest.sql", "/var/backups/latest.sql"},
+	}
+
+	for _, tt := range tests {
+		if actual := config.ResolvePath(tt.path); actual != tt.expected {
+			t.Errorf("ResolvePath(%q) = %q, expected %q", tt.path, actual, tt.expected)
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	if actual := config.ResolveOptionPath("dumps/latest.sql", true); actual != filepath.Join(cwd, "dumps/latest.sql") {
+		t.Errorf("Expected given paths to resolve against the current directory, got %q", actual)
+	}
+	if actual := config.ResolveOptionPath("dumps/latest.sql", false); actual != filepath.Join(expectedDir, "dumps/latest.sql") {
+		t.Errorf("Expected defaults to resolve against the Kookfile directory, got %q", actual)
+	}
+}
+
+// Test that user-defined types are resolved to their base type
+func TestResolveOptionTypes(t *testing.T) {
+	config, err := Load("testdata/valid/with_all_features.yaml")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	var version *Option
+	for i, opt := range config.Commands[0].Options {
+		if opt.Name == "version" {
+			version = &config.Commands[0].Options[i]
+		}
+	}
+	if version == nil {
+		t.Fatal("Expected option 'version' in with_all_features.yaml")
+	}
+
+	if version.Type != "str" {
+		t.Errorf("Expected type to resolve to 'str', got: %s", version.Type)
+	}
+	if version.Description != "Semantic version" {
+		t.Errorf("Expected description from type, got: %s", version.Description)
+	}
+	if version.Pattern == "" {
+		t.Error("Expected pattern from type")
+	}
+}
+
+// Test splitting dependencies into command and arguments
+func TestParseDep(t *testing.T) {
+	name, args, err := ParseDep(`build --target=prod --label "nightly build"`)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if name != "build" {
+		t.Errorf("Expected name 'build', got: %s", name)
+	}
+	if len(args) != 3 || args[0] != "--target=prod" || args[2] != "nightly build" {
+		t.Errorf("Expected 3 parsed arguments, got: %q", args)
+	}
+}
+
+// Test that shells are read as a name or a command line
+func TestShellUnmarshal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Shell
+	}{
+		{"shell: python3", Shell{"python3"}},
+		{"shell: [deno, run, --allow-read]", Shell{"deno", "run", "--allow-read"}},
+		{"shell: []", Shell{}},
+	}
+
+	for _, tt := range tests {
+		var cmd Command
+		if err := yaml.Unmarshal([]byte(tt.input), &cmd); err != nil {
+			t.Errorf("Unexpected error for %q: %v", tt.input, err)
+			continue
+		}
+		if !slices.Equal(cmd.Shell, tt.expected) {
+			t.Errorf("For %q expected %v, got %v", tt.input, tt.expected, cmd.Shell)
+		}
+	}
+
+	cfg := &Config{Shell: Shell{"sh"}}
+	if shell := cfg.CommandShell(Command{}); !slices.Equal(shell, Shell{"sh"}) {
+		t.Errorf("Expected top-level shell, got %v", shell)
+	}
+	if shell := cfg.CommandShell(Command{Shell: Shell{"zsh"}}); !slices.Equal(shell, Shell{"zsh"}) {
+		t.Errorf("Expected command shell, got %v", shell)
+	}
+	if shell := (&Config{}).CommandShell(Command{}); !slices.Equal(shell, Shell{"bash"}) {
+		t.Errorf("Expected bash by default, got %v", shell)
+	}
+	builtin := &Config{Shell: Shell{"builtin"}}
+	if shell := builtin.CommandShell(Command{Container: &Container{Image: "alpine"}}); !slices.Equal(shell, Shell{"sh"}) {
+		t.Errorf("Expected sh in containers, got %v", shell)
+	}
+	if err := validateShell(Shell{"python3", " "}); err == nil {
+		t.Error("Expected error for empty shell argument")
+	}
+}
+
+// Test strict mode defaults and overrides
+func TestIsStrict(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name     string
+		config   Config
+		cmd      Command
+		expected bool
+	}{
+		{"version 1 default", Config{Version: 1}, Command{}, false},
+		{"version 2 default", Config{Version: 2}, Command{}, true},
+		{"top-level on", Config{Version: 1, Strict: &on}, Command{}, true},
+		{"top-level off", Config{Version: 2, Strict: &off}, Command{}, false},
+		{"command overrides", Config{Version: 1, Strict: &on}, Command{Strict: &off}, false},
+		{"command on", Config{Version: 1}, Command{Strict: &on}, true},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.config.IsStrict(tt.cmd); actual != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, actual)
+		}
+	}
+}
@@ -1,12 +1,31 @@
 package config
 
-import "strings"
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v3"
+)
 
 type Config struct {
-	Version   int                    `yaml:"version"`
-	Variables []Variable             `yaml:"variables"`
-	Commands  []Command              `yaml:"commands"`
-	VarMap    map[string]interface{} `yaml:"-"`
+	Version        int                    `yaml:"version"`
+	DefaultDir     string                 `yaml:"default_dir,omitempty"`
+	Env            map[string]string      `yaml:"env,omitempty"`
+	EnvClear       bool                   `yaml:"env_clear,omitempty"`
+	EnvPassthrough []string               `yaml:"env_passthrough,omitempty"`
+	Shell          Shell                  `yaml:"shell,omitempty"`
+	Strict         *bool                  `yaml:"strict,omitempty"`
+	Types          []OptionType           `yaml:"types"`
+	OptionSets     map[string][]Option    `yaml:"option_sets"`
+	Options        []Option               `yaml:"options"`
+	Variables      []Variable             `yaml:"variables"`
+	Commands       []Command              `yaml:"commands"`
+	VarMap         map[string]interface{} `yaml:"-"`
+	Dir            string                 `yaml:"-"` // Directory containing the Kookfile
 }
 
 type Variable struct {
@@ -15,22 +34,198 @@ type Variable struct {
 }
 
 type Command struct {
-	Name        string   `yaml:"name"`
-	Aliases     []string `yaml:"aliases"`
-	Description string   `yaml:"description,omitempty"`
-	Help        string   `yaml:"help,omitempty"`
-	Options     []Option `yaml:"options"`
-	Script      string   `yaml:"script"`
-	Silent      bool     `yaml:"silent,omitempty"`
+	Name           string            `yaml:"name"`
+	Aliases        []string          `yaml:"aliases"`
+	Description    string            `yaml:"description,omitempty"`
+	Help           string            `yaml:"help,omitempty"`
+	UseOptions     []string          `yaml:"use_options,omitempty"`
+	Options        []Option          `yaml:"options"`
+	Script         string            `yaml:"script"`
+	Silent         bool              `yaml:"silent,omitempty"`
+	Passthrough    bool              `yaml:"passthrough,omitempty"`
+	Deps           []string          `yaml:"deps,omitempty"`
+	Sources        []string          `yaml:"sources,omitempty"`
+	Generates      []string          `yaml:"generates,omitempty"`
+	Watch          []string          `yaml:"watch,omitempty"`
+	Timeout        string            `yaml:"timeout,omitempty"`
+	Retry          *Retry            `yaml:"retry,omitempty"`
+	Dir            string            `yaml:"dir,omitempty"`
+	Env            map[string]string `yaml:"env,omitempty"`
+	EnvClear       bool              `yaml:"env_clear,omitempty"`
+	EnvPassthrough []string          `yaml:"env_passthrough,omitempty"`
+	Shell          Shell             `yaml:"shell,omitempty"`
+	Strict         *bool             `yaml:"strict,omitempty"`
+	Container      *Container        `yaml:"container,omitempty"`
+}
+
+// Container runs a command's script in a container with the project mounted,
+// using docker or podman
+type Container struct {
+	Image   string            `yaml:"image"`
+	Engine  string            `yaml:"engine,omitempty"`
+	Volumes []string          `yaml:"volumes,omitempty"`
+	Workdir string            `yaml:"workdir,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// Shell is the program running a command's script. It is written as a name
+// (shell: python3) or as a command line (shell: [deno, run, --allow-read]).
+type Shell []string
+
+// UnmarshalYAML accepts a single name as well as a list
+func (s *Shell) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = Shell{value.Value}
+		return nil
+	}
+
+	var argv []string
+	if err := value.Decode(&argv); err != nil {
+		return err
+	}
+	*s = argv
+	return nil
+}
+
+// IsStrict reports whether a command's script stops at the first failing
+// line: the command's strict setting, else the top-level one, else the
+// default of the config version (on from version 2)
+func (c *Config) IsStrict(cmd Command) bool {
+	if cmd.Strict != nil {
+		return *cmd.Strict
+	}
+	if c.Strict != nil {
+		return *c.Strict
+	}
+	return c.Version >= 2
+}
+
+// IsBuiltin reports whether scripts run with kook's embedded POSIX shell
+// (shell: builtin), which works on systems without bash
+func (s Shell) IsBuiltin() bool {
+	return len(s) == 1 && s[0] == "builtin"
+}
+
+// CommandShell returns the shell running a command's script: the command's
+// own, else the top-level one. Container commands run their own shell or sh,
+// which most images provide; the top-level shell is the host's.
+func (c *Config) CommandShell(cmd Command) Shell {
+	if len(cmd.Shell) > 0 {
+		return cmd.Shell
+	}
+	if cmd.Container != nil {
+		return Shell{"sh"}
+	}
+	return c.HostShell()
+}
+
+// HostShell returns the top-level shell, running scripts on the host unless
+// a command sets its own, else bash
+func (c *Config) HostShell() Shell {
+	if len(c.Shell) > 0 {
+		return c.Shell
+	}
+	return Shell{"bash"}
+}
+
+// Retry runs a failing command again, waiting delay between attempts. The
+// delay doubles after each attempt with exponential backoff.
+type Retry struct {
+	Attempts    int    `yaml:"attempts"`
+	Delay       string `yaml:"delay,omitempty"`
+	Backoff     string `yaml:"backoff,omitempty"`
+	OnExitCodes []int  `yaml:"on_exit_codes,omitempty"`
 }
 
 type Option struct {
-	Name        string `yaml:"name"`
-	Shorthand   string `yaml:"shorthand,omitempty"`
-	Description string `yaml:"description,omitempty"`
-	Var         string `yaml:"var,omitempty"`
-	Type        string `yaml:"type"`
-	Mandatory   bool   `yaml:"mandatory,omitempty"`
+	Name            string            `yaml:"name"`
+	Shorthand       string            `yaml:"shorthand,omitempty"`
+	Aliases         []string          `yaml:"aliases,omitempty"`
+	Description     string            `yaml:"description,omitempty"`
+	Var             string            `yaml:"var,omitempty"`
+	Type            string            `yaml:"type"`
+	Mandatory       bool              `yaml:"mandatory,omitempty"`
+	Default         string            `yaml:"default,omitempty"`
+	Env             string            `yaml:"env,omitempty"`
+	MustExist       bool              `yaml:"must_exist,omitempty"`
+	Extensions      []string          `yaml:"extensions,omitempty"`
+	Secret          bool              `yaml:"secret,omitempty"`
+	ConflictsWith   []string          `yaml:"conflicts_with,omitempty"`
+	Requires        []string          `yaml:"requires,omitempty"`
+	RequiredIf      map[string]string `yaml:"required_if,omitempty"`
+	Pattern         string            `yaml:"pattern,omitempty"`
+	Choices         []string          `yaml:"choices,omitempty"`
+	Min             *float64          `yaml:"min,omitempty"`
+	Max             *float64          `yaml:"max,omitempty"`
+	Complete        string            `yaml:"complete,omitempty"`
+	CompleteTimeout string            `yaml:"complete_timeout,omitempty"`
+
+	// keys holds the fields written in the Kookfile, so that an override
+	// of a set option can also reset a field (mandatory: false)
+	keys map[string]bool
+}
+
+// sets reports whether the Kookfile writes the field with this key
+func (o Option) sets(key string) bool {
+	return o.keys[key]
+}
+
+// UnmarshalYAML records which fields the option sets
+func (o *Option) UnmarshalYAML(value *yaml.Node) error {
+	type plain Option
+	if err := value.Decode((*plain)(o)); err != nil {
+		return err
+	}
+
+	if value.Kind == yaml.MappingNode {
+		o.keys = make(map[string]bool)
+		for i := 0; i < len(value.Content); i += 2 {
+			o.keys[value.Content[i].Value] = true
+		}
+	}
+	return nil
+}
+
+// OptionType is a user-defined type: a base type plus reusable constraints
+// that options pick up by using the type name
+type OptionType struct {
+	Name            string   `yaml:"name"`
+	Base            string   `yaml:"base"`
+	Description     string   `yaml:"description,omitempty"`
+	Pattern         string   `yaml:"pattern,omitempty"`
+	Choices         []string `yaml:"choices,omitempty"`
+	Min             *float64 `yaml:"min,omitempty"`
+	Max             *float64 `yaml:"max,omitempty"`
+	Complete        string   `yaml:"complete,omitempty"`
+	CompleteTimeout string   `yaml:"complete_timeout,omitempty"`
+}
+
+// Apply resolves an option using this type to the base type, filling in
+// the type's settings wherever the option does not declare its own
+func (t OptionType) Apply(opt Option) Option {
+	opt.Type = t.Base
+	if opt.Description == "" {
+		opt.Description = t.Description
+	}
+	if opt.Pattern == "" {
+		opt.Pattern = t.Pattern
+	}
+	if len(opt.Choices) == 0 {
+		opt.Choices = t.Choices
+	}
+	if opt.Min == nil {
+		opt.Min = t.Min
+	}
+	if opt.Max == nil {
+		opt.Max = t.Max
+	}
+	if opt.Complete == "" {
+		opt.Complete = t.Complete
+		if opt.CompleteTimeout == "" {
+			opt.CompleteTimeout = t.CompleteTimeout
+		}
+	}
+	return opt
 }
 
 func (o Option) GetVarName() string {
@@ -39,3 +234,86 @@ func (o Option) GetVarName() string {
 	}
 	return strings.ReplaceAll(o.Name, "-", "_")
 }
+
+// FindCommand returns the command with the given name or alias
+func (c *Config) FindCommand(name string) (Command, bool) {
+	for _, cmd := range c.Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// ParseDep splits a dependency such as "build --target=prod" into the
+// command name and the arguments to run it with
+func ParseDep(dep string) (string, []string, error) {
+	words, err := shellquote.Split(dep)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid dependency '%s': %w", dep, err)
+	}
+	if len(words) == 0 {
+		return "", nil, fmt.Errorf("dependency cannot be empty")
+	}
+	return words[0], words[1:], nil
+}
+
+// CommandOptions returns the options available to a command: the global
+// options followed by the command's own options
+func (c *Config) CommandOptions(cmd Command) []Option {
+	options := make([]Option, 0, len(c.Options)+len(cmd.Options))
+	options = append(options, c.Options...)
+	return append(options, cmd.Options...)
+}
+
+// RetriesOn reports whether a failure with the given exit code is retried:
+// any failure when no exit codes are listed, otherwise only those listed
+func (r Retry) RetriesOn(code int) bool {
+	return len(r.OnExitCodes) == 0 || slices.Contains(r.OnExitCodes, code)
+}
+
+// IsNegatable reports whether the option gets a --no-<name> flag, which is
+// the case for bool options enabled by default
+func (o Option) IsNegatable() bool {
+	enabled, _ := strconv.ParseBool(o.Default)
+	return o.Type == "bool" && enabled
+}
+
+// NegationName returns the name of the flag disabling a negatable option
+func (o Option) NegationName() string {
+	return "no-" + o.Name
+}
+
+// IsPathType reports whether the option holds a filesystem path
+func (o Option) IsPathType() bool {
+	return o.Type == "path" || o.Type == "file" || o.Type == "dir"
+}
+
+// ResolvePath returns an absolute, cleaned path, resolving relative paths
+// against the directory containing the Kookfile
+func (c *Config) ResolvePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// ResolveOptionPath resolves a path option value. Values given by the user
+// are relative to the current directory, like shell completion, while
+// defaults are relative to the Kookfile.
+func (c *Config) ResolveOptionPath(path string, given bool) string {
+	if given && path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	}
+	return c.ResolvePath(path)
+}
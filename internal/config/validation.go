@@ -2,27 +2,59 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 var (
 	validNamePattern      = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
 	validShorthandPattern = regexp.MustCompile(`^[a-zA-Z]$`)
 	validVarPattern       = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
-	reservedShorthands    = map[string]bool{"h": true, "i": true}
-	validTypes            = map[string]bool{
-		"bool":  true,
-		"str":   true,
-		"int":   true,
-		"float": true,
+	reservedShorthands    = map[string]bool{"h": true, "i": true, "j": true}
+	reservedVarNames      = map[string]bool{"kookfile_dir": true, "invocation_dir": true}
+	reservedOptionNames   = map[string]bool{"help": true, "interactive": true, "jobs": true, "keep-going": true}
+	// shadowableFlagNames are built-in flags a command option can take over:
+	// the command gets its own option instead of the built-in flag
+	shadowableFlagNames = map[string]bool{"force": true, "watch": true, "timeout": true}
+	validTypes          = map[string]bool{
+		"bool":     true,
+		"str":      true,
+		"int":      true,
+		"float":    true,
+		"path":     true,
+		"file":     true,
+		"dir":      true,
+		"duration": true,
+		"count":    true,
 	}
 )
 
 // validateConfig validates the entire configuration
 func validateConfig(config *Config) error {
 	// Validate version
-	if config.Version != 1 {
-		return fmt.Errorf("unsupported config version: %d (expected 1)", config.Version)
+	if config.Version != 1 && config.Version != 2 {
+		return fmt.Errorf("unsupported config version: %d (expected 1 or 2)", config.Version)
+	}
+
+	if config.DefaultDir != "" && config.DefaultDir != "kookfile" && config.DefaultDir != "invocation" {
+		return fmt.Errorf("invalid default_dir '%s': must be kookfile or invocation", config.DefaultDir)
+	}
+
+	if err := validateEnv(config.Env, config.EnvPassthrough); err != nil {
+		return err
+	}
+
+	if err := validateShell(config.Shell); err != nil {
+		return err
 	}
 
 	// Must have at least one command
@@ -30,6 +62,45 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("config must have at least one command")
 	}
 
+	// Validate user-defined option types
+	typeNames := make(map[string]bool)
+	for i, t := range config.Types {
+		if err := validateOptionType(t); err != nil {
+			return fmt.Errorf("type %d (%s): %w", i, t.Name, err)
+		}
+
+		if typeNames[t.Name] {
+			return fmt.Errorf("duplicate type name: %s", t.Name)
+		}
+		typeNames[t.Name] = true
+	}
+
+	// Splice shared option sets into the commands using them
+	if err := expandOptionSets(config); err != nil {
+		return err
+	}
+
+	// Resolve user-defined types so options are validated against their base type
+	resolveOptionTypes(config)
+
+	// Validate option sets, including those no command uses
+	if err := validateOptionSets(config); err != nil {
+		return err
+	}
+
+	// Validate global options
+	if err := validateOptions(config.Options, make(map[string]bool), make(map[string]bool)); err != nil {
+		return fmt.Errorf("global %w", err)
+	}
+	// Global options share the flag namespace of the built-in flags
+	for i, opt := range config.Options {
+		for _, name := range append([]string{opt.Name}, opt.Aliases...) {
+			if shadowableFlagNames[name] {
+				return fmt.Errorf("global option %d (%s): option name '%s' is reserved for a built-in flag", i, opt.Name, name)
+			}
+		}
+	}
+
 	// Validate variables
 	for i, v := range config.Variables {
 		if err := validateVariable(v); err != nil {
@@ -40,10 +111,15 @@ func validateConfig(config *Config) error {
 	// Validate commands
 	commandNames := make(map[string]bool)
 	for i, cmd := range config.Commands {
-		if err := validateCommand(cmd); err != nil {
+		if err := validateCommand(cmd, config.Options...); err != nil {
 			return fmt.Errorf("command %d (%s): %w", i, cmd.Name, err)
 		}
 
+		// The builtin shell runs in kook itself, not in the container
+		if cmd.Container != nil && config.CommandShell(cmd).IsBuiltin() {
+			return fmt.Errorf("command %d (%s): container commands cannot use the builtin shell", i, cmd.Name)
+		}
+
 		// Check for duplicate command names
 		if commandNames[cmd.Name] {
 			return fmt.Errorf("duplicate command name: %s", cmd.Name)
@@ -59,6 +135,211 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	// Validate dependencies once all command names are known
+	if err := validateDeps(config); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateDeps checks that dependencies reference existing commands and
+// that no command depends on itself, directly or not
+func validateDeps(config *Config) error {
+	graph := make(map[string][]string)
+	for i, cmd := range config.Commands {
+		for _, dep := range cmd.Deps {
+			name, _, err := ParseDep(dep)
+			if err != nil {
+				return fmt.Errorf("command %d (%s): %w", i, cmd.Name, err)
+			}
+
+			target, ok := config.FindCommand(name)
+			if !ok {
+				return fmt.Errorf("command %d (%s): dependency '%s' references unknown command '%s'", i, cmd.Name, dep, name)
+			}
+			graph[cmd.Name] = append(graph[cmd.Name], target.Name)
+		}
+	}
+
+	// Depth-first search keeping the current path to report cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := slices.Index(path, name)
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range graph[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, cmd := range config.Commands {
+		if err := visit(cmd.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateOptionType validates a user-defined option type
+func validateOptionType(t OptionType) error {
+	if t.Name == "" {
+		return fmt.Errorf("type name cannot be empty")
+	}
+
+	if !validNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid type name '%s': must start with letter and contain only letters, numbers, hyphens, and underscores", t.Name)
+	}
+
+	if validTypes[t.Name] {
+		return fmt.Errorf("type name '%s' is a built-in type", t.Name)
+	}
+
+	if !validTypes[t.Base] {
+		return fmt.Errorf("invalid base type '%s': must be a built-in type", t.Base)
+	}
+
+	// A type is valid when an option using it would be
+	return validateOption(t.Apply(Option{Name: t.Name}))
+}
+
+// resolveOptionTypes replaces user-defined type names in global, command
+// and option set options with their base type and settings
+func resolveOptionTypes(config *Config) {
+	types := make(map[string]OptionType)
+	for _, t := range config.Types {
+		types[t.Name] = t
+	}
+
+	resolve := func(options []Option) {
+		for i, opt := range options {
+			if t, ok := types[opt.Type]; ok {
+				options[i] = t.Apply(opt)
+			}
+		}
+	}
+
+	resolve(config.Options)
+	for i := range config.Commands {
+		resolve(config.Commands[i].Options)
+	}
+	for _, options := range config.OptionSets {
+		resolve(options)
+	}
+}
+
+// expandOptionSets prepends the options of each set listed in use_options to
+// the command options. A command option with the same name as a set option
+// overrides the fields it sets instead of being added. Once spliced,
+// use_options is cleared so expanding again is a no-op.
+func expandOptionSets(config *Config) error {
+	for i, cmd := range config.Commands {
+		if len(cmd.UseOptions) == 0 {
+			continue
+		}
+
+		own := make(map[string]int)
+		for j, opt := range cmd.Options {
+			own[opt.Name] = j
+		}
+
+		var options []Option
+		overridden := make(map[int]bool)
+		for _, setName := range cmd.UseOptions {
+			set, ok := config.OptionSets[setName]
+			if !ok {
+				return fmt.Errorf("command %d (%s): unknown option set '%s'", i, cmd.Name, setName)
+			}
+
+			for _, opt := range set {
+				if j, ok := own[opt.Name]; ok {
+					opt = mergeOption(opt, cmd.Options[j])
+					overridden[j] = true
+				}
+				options = append(options, opt)
+			}
+		}
+
+		for j, opt := range cmd.Options {
+			if !overridden[j] {
+				options = append(options, opt)
+			}
+		}
+
+		config.Commands[i].Options = options
+		config.Commands[i].UseOptions = nil
+	}
+
+	return nil
+}
+
+// mergeOption overlays every field set in override onto base: the fields
+// written in the Kookfile, zero values included, or the non-zero ones for
+// options built in code. Giving a default to a mandatory option makes it
+// optional unless the override sets mandatory too.
+func mergeOption(base, override Option) Option {
+	merged := base
+	src := reflect.ValueOf(override)
+	dst := reflect.ValueOf(&merged).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if override.sets(key) || (override.keys == nil && !src.Field(i).IsZero()) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	if override.Default != "" && !override.sets("mandatory") {
+		merged.Mandatory = false
+	}
+	return merged
+}
+
+// validateOptionSets validates the name and options of every option set
+func validateOptionSets(config *Config) error {
+	names := make([]string, 0, len(config.OptionSets))
+	for name := range config.OptionSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !validNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid option set name '%s': must start with letter and contain only letters, numbers, hyphens, and underscores", name)
+		}
+
+		for i, opt := range config.OptionSets[name] {
+			if err := validateOption(opt); err != nil {
+				return fmt.Errorf("option set %s: option %d (%s): %w", name, i, opt.Name, err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -72,11 +353,16 @@ func validateVariable(v Variable) error {
 		return fmt.Errorf("invalid variable name '%s': must start with letter and contain only letters, numbers, hyphens, and underscores", v.Name)
 	}
 
+	if reservedVarNames[v.Name] {
+		return fmt.Errorf("variable name '%s' is reserved", v.Name)
+	}
+
 	return nil
 }
 
-// validateCommand validates a single command
-func validateCommand(cmd Command) error {
+// validateCommand validates a single command, whose options must not clash
+// with the global options
+func validateCommand(cmd Command, globalOptions ...Option) error {
 	if cmd.Name == "" {
 		return fmt.Errorf("command name cannot be empty")
 	}
@@ -96,27 +382,245 @@ func validateCommand(cmd Command) error {
 		}
 	}
 
-	// Validate options
+	// Passthrough commands reserve .args for the extra arguments
+	if cmd.Passthrough {
+		for _, opt := range append(append([]Option{}, globalOptions...), cmd.Options...) {
+			if opt.GetVarName() == "args" {
+				return fmt.Errorf("option %s: var name 'args' is reserved for passthrough arguments", opt.Name)
+			}
+		}
+	}
+
+	if cmd.Dir != "" {
+		if _, err := template.New("dir").Parse(cmd.Dir); err != nil {
+			return fmt.Errorf("invalid dir template: %w", err)
+		}
+	}
+
+	if err := validateEnv(cmd.Env, cmd.EnvPassthrough); err != nil {
+		return err
+	}
+
+	if err := validateShell(cmd.Shell); err != nil {
+		return err
+	}
+
+	if cmd.Container != nil {
+		if err := validateContainer(*cmd.Container); err != nil {
+			return fmt.Errorf("container: %w", err)
+		}
+	}
+
+	if cmd.Timeout != "" {
+		if d, err := time.ParseDuration(cmd.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout '%s': must be a positive duration (e.g. 30s, 10m)", cmd.Timeout)
+		}
+	}
+
+	if cmd.Retry != nil {
+		if err := validateRetry(*cmd.Retry); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+
+	// Up-to-date checks need sources to fingerprint
+	if len(cmd.Generates) > 0 && len(cmd.Sources) == 0 {
+		return fmt.Errorf("generates requires sources")
+	}
+	patterns := append(append(append([]string{}, cmd.Sources...), cmd.Generates...), cmd.Watch...)
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(filepath.ToSlash(pattern)) {
+			return fmt.Errorf("invalid glob pattern '%s'", pattern)
+		}
+	}
+
+	// Global options are validated on their own, only reserve their names here
 	optionNames := make(map[string]bool)
 	shorthands := make(map[string]bool)
+	for _, opt := range globalOptions {
+		registerOptionNames(opt, optionNames, shorthands)
+	}
+
+	return validateOptions(cmd.Options, optionNames, shorthands)
+}
+
+// validateEnv checks the names and value templates of an env map, and the
+// names listed in env_passthrough
+func validateEnv(env map[string]string, passthrough []string) error {
+	for name, value := range env {
+		if !validVarPattern.MatchString(name) {
+			return fmt.Errorf("invalid env var name '%s': must start with letter or underscore and contain only letters, numbers, and underscores", name)
+		}
+		if _, err := template.New(name).Parse(value); err != nil {
+			return fmt.Errorf("env %s: invalid template: %w", name, err)
+		}
+	}
+
+	for _, name := range passthrough {
+		if !validVarPattern.MatchString(name) {
+			return fmt.Errorf("invalid env_passthrough name '%s': must start with letter or underscore and contain only letters, numbers, and underscores", name)
+		}
+	}
+
+	return nil
+}
+
+func validateShell(shell Shell) error {
+	for _, arg := range shell {
+		if strings.TrimSpace(arg) == "" {
+			return fmt.Errorf("shell cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+func validateContainer(container Container) error {
+	if container.Image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if _, err := template.New("image").Parse(container.Image); err != nil {
+		return fmt.Errorf("invalid image template: %w", err)
+	}
+
+	if container.Engine != "" && container.Engine != "docker" && container.Engine != "podman" {
+		return fmt.Errorf("invalid engine '%s': must be docker or podman", container.Engine)
+	}
+
+	if container.Workdir != "" && !strings.HasPrefix(container.Workdir, "/") {
+		return fmt.Errorf("invalid workdir '%s': must be an absolute path in the container", container.Workdir)
+	}
+
+	for _, volume := range container.Volumes {
+		parts := strings.Split(volume, ":")
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid volume '%s': must be host:container[:options]", volume)
+		}
+	}
+
+	return validateEnv(container.Env, nil)
+}
+
+func validateRetry(retry Retry) error {
+	if retry.Attempts < 1 {
+		return fmt.Errorf("attempts must be at least 1")
+	}
 
-	for i, opt := range cmd.Options {
+	if retry.Delay != "" {
+		if d, err := time.ParseDuration(retry.Delay); err != nil || d < 0 {
+			return fmt.Errorf("invalid delay '%s': must be a duration (e.g. 2s, 1m)", retry.Delay)
+		}
+	}
+
+	if retry.Backoff != "" && retry.Backoff != "constant" && retry.Backoff != "exponential" {
+		return fmt.Errorf("invalid backoff '%s': must be constant or exponential", retry.Backoff)
+	}
+
+	for _, code := range retry.OnExitCodes {
+		if code < 1 || code > 255 {
+			return fmt.Errorf("invalid exit code %d: must be between 1 and 255", code)
+		}
+	}
+
+	return nil
+}
+
+// validateOptions validates options sharing one flag namespace. optionNames
+// and shorthands hold the names already taken, such as by global options.
+func validateOptions(options []Option, optionNames, shorthands map[string]bool) error {
+	for i, opt := range options {
 		if err := validateOption(opt); err != nil {
 			return fmt.Errorf("option %d (%s): %w", i, opt.Name, err)
 		}
 
-		// Check for duplicate option names
-		if optionNames[opt.Name] {
-			return fmt.Errorf("duplicate option name: %s", opt.Name)
+		if err := registerOptionNames(opt, optionNames, shorthands); err != nil {
+			return err
+		}
+	}
+
+	// Validate option relationships once all option names are known
+	for _, opt := range options {
+		if err := validateOptionRelations(opt, optionNames); err != nil {
+			return fmt.Errorf("option %s: %w", opt.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// registerOptionNames records the flag names and shorthand of an option,
+// failing when one of them is already taken
+func registerOptionNames(opt Option, optionNames, shorthands map[string]bool) error {
+	// Built-in flags are available to every command
+	for _, name := range append([]string{opt.Name}, opt.Aliases...) {
+		if reservedOptionNames[name] {
+			return fmt.Errorf("option name '%s' is reserved for a built-in flag", name)
+		}
+	}
+
+	// Check for duplicate option names
+	if optionNames[opt.Name] {
+		return fmt.Errorf("duplicate option name: %s", opt.Name)
+	}
+	optionNames[opt.Name] = true
+
+	// Aliases share the option name space
+	for _, alias := range opt.Aliases {
+		if optionNames[alias] {
+			return fmt.Errorf("duplicate option name/alias: %s", alias)
 		}
-		optionNames[opt.Name] = true
+		optionNames[alias] = true
+	}
 
-		// Check for duplicate shorthands
-		if opt.Shorthand != "" {
-			if shorthands[opt.Shorthand] {
-				return fmt.Errorf("duplicate shorthand: %s", opt.Shorthand)
+	// Negatable bools also register --no-<name> for the name and each alias
+	if opt.IsNegatable() {
+		for _, name := range append([]string{opt.Name}, opt.Aliases...) {
+			negation := "no-" + name
+			if optionNames[negation] {
+				return fmt.Errorf("duplicate option name: %s", negation)
 			}
-			shorthands[opt.Shorthand] = true
+			optionNames[negation] = true
+		}
+	}
+
+	// Check for duplicate shorthands
+	if opt.Shorthand != "" {
+		if shorthands[opt.Shorthand] {
+			return fmt.Errorf("duplicate shorthand: %s", opt.Shorthand)
+		}
+		shorthands[opt.Shorthand] = true
+	}
+
+	return nil
+}
+
+// validateOptionRelations checks that conflicts_with, requires and
+// required_if reference other options of the same command
+func validateOptionRelations(opt Option, optionNames map[string]bool) error {
+	check := func(field, ref string) error {
+		if ref == opt.Name || slices.Contains(opt.Aliases, ref) {
+			return fmt.Errorf("%s cannot reference the option itself", field)
+		}
+		if !optionNames[ref] {
+			return fmt.Errorf("%s references unknown option '%s'", field, ref)
+		}
+		return nil
+	}
+
+	for _, ref := range opt.ConflictsWith {
+		if err := check("conflicts_with", ref); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range opt.Requires {
+		if err := check("requires", ref); err != nil {
+			return err
+		}
+	}
+
+	for ref := range opt.RequiredIf {
+		if err := check("required_if", ref); err != nil {
+			return err
 		}
 	}
 
@@ -133,9 +637,69 @@ func validateOption(opt Option) error {
 		return fmt.Errorf("invalid option name '%s': must start with letter and contain only letters, numbers, hyphens, and underscores", opt.Name)
 	}
 
+	// Validate aliases
+	for _, alias := range opt.Aliases {
+		if !validNamePattern.MatchString(alias) {
+			return fmt.Errorf("invalid alias '%s': must start with letter and contain only letters, numbers, hyphens, and underscores", alias)
+		}
+	}
+
 	// Validate type
 	if !validTypes[opt.Type] {
-		return fmt.Errorf("invalid option type '%s': must be bool, str, int, or float", opt.Type)
+		return fmt.Errorf("invalid option type '%s': must be bool, str, int, float, path, file, dir, duration, count, or a name from types", opt.Type)
+	}
+
+	// Validate value constraints
+	if err := validateConstraints(opt); err != nil {
+		return err
+	}
+
+	// Validate default value against the option type
+	if opt.Default != "" {
+		if opt.Mandatory {
+			return fmt.Errorf("mandatory option cannot have a default")
+		}
+		if err := validateDefault(opt); err != nil {
+			return fmt.Errorf("invalid default '%s': %w", opt.Default, err)
+		}
+		if err := opt.CheckValue(opt.Default); err != nil {
+			return fmt.Errorf("invalid default '%s': %w", opt.Default, err)
+		}
+	}
+
+	// Only string values can be masked
+	if opt.Secret && opt.Type != "str" {
+		return fmt.Errorf("secret is only supported for str options")
+	}
+
+	// Validate dynamic completion
+	if opt.Complete != "" && (opt.Type == "bool" || opt.Type == "count" || opt.IsPathType()) {
+		return fmt.Errorf("complete is not supported for %s options", opt.Type)
+	}
+
+	if opt.CompleteTimeout != "" {
+		if opt.Complete == "" {
+			return fmt.Errorf("complete_timeout requires complete")
+		}
+		if d, err := time.ParseDuration(opt.CompleteTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid complete_timeout '%s': must be a positive duration (e.g. 5s)", opt.CompleteTimeout)
+		}
+	}
+
+	// Validate path constraints
+	if opt.MustExist && !opt.IsPathType() {
+		return fmt.Errorf("must_exist is only supported for path, file, and dir options")
+	}
+
+	if len(opt.Extensions) > 0 {
+		if opt.Type != "path" && opt.Type != "file" {
+			return fmt.Errorf("extensions are only supported for path and file options")
+		}
+		for _, ext := range opt.Extensions {
+			if !strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.ContainsAny(ext, `/\`) {
+				return fmt.Errorf("invalid extension '%s': must start with a dot (e.g. .yaml)", ext)
+			}
+		}
 	}
 
 	// Validate shorthand
@@ -145,7 +709,7 @@ func validateOption(opt Option) error {
 		}
 
 		if reservedShorthands[opt.Shorthand] {
-			return fmt.Errorf("shorthand '%s' is reserved (used by -h/--help or -i/--interactive)", opt.Shorthand)
+			return fmt.Errorf("shorthand '%s' is reserved (used by -h/--help, -i/--interactive or -j/--jobs)", opt.Shorthand)
 		}
 	}
 
@@ -156,5 +720,127 @@ func validateOption(opt Option) error {
 		}
 	}
 
+	if reservedVarNames[opt.GetVarName()] {
+		return fmt.Errorf("var name '%s' is reserved", opt.GetVarName())
+	}
+
+	// Validate env var name if provided
+	if opt.Env != "" {
+		if !validVarPattern.MatchString(opt.Env) {
+			return fmt.Errorf("invalid env var name '%s': must start with letter or underscore and contain only letters, numbers, and underscores", opt.Env)
+		}
+	}
+
+	return nil
+}
+
+// validateDefault checks that a default value can be parsed as the option type
+func validateDefault(opt Option) error {
+	switch opt.Type {
+	case "bool":
+		if _, err := strconv.ParseBool(opt.Default); err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+	case "int":
+		if _, err := strconv.Atoi(opt.Default); err != nil {
+			return fmt.Errorf("must be a valid integer")
+		}
+	case "count":
+		if n, err := strconv.Atoi(opt.Default); err != nil || n < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+	case "float":
+		if _, err := strconv.ParseFloat(opt.Default, 64); err != nil {
+			return fmt.Errorf("must be a valid number")
+		}
+	case "duration":
+		if _, err := time.ParseDuration(opt.Default); err != nil {
+			return fmt.Errorf("must be a valid duration (e.g. 30s, 5m, 1h30m)")
+		}
+	}
+
 	return nil
 }
+
+// validateConstraints checks that pattern, choices, min and max fit the
+// option type
+func validateConstraints(opt Option) error {
+	if opt.Pattern != "" {
+		if opt.Type != "str" {
+			return fmt.Errorf("pattern is only supported for str options")
+		}
+		if _, err := regexp.Compile(opt.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", opt.Pattern, err)
+		}
+	}
+
+	if len(opt.Choices) > 0 {
+		if opt.Type != "str" && opt.Type != "int" && opt.Type != "float" {
+			return fmt.Errorf("choices are only supported for str, int, and float options")
+		}
+		if opt.Complete != "" {
+			return fmt.Errorf("choices and complete cannot be used together")
+		}
+		for _, choice := range opt.Choices {
+			if err := validateDefault(Option{Type: opt.Type, Default: choice}); err != nil {
+				return fmt.Errorf("invalid choice '%s': %w", choice, err)
+			}
+		}
+	}
+
+	if opt.Min != nil || opt.Max != nil {
+		if opt.Type != "int" && opt.Type != "float" && opt.Type != "count" {
+			return fmt.Errorf("min and max are only supported for int, float, and count options")
+		}
+		if opt.Min != nil && opt.Max != nil && *opt.Min > *opt.Max {
+			return fmt.Errorf("min (%v) cannot be greater than max (%v)", *opt.Min, *opt.Max)
+		}
+	}
+
+	return nil
+}
+
+// CheckValue checks a value against the option's choices, pattern and bounds
+func (o Option) CheckValue(value string) error {
+	if len(o.Choices) > 0 && !o.hasChoice(value) {
+		return fmt.Errorf("must be one of: %s", strings.Join(o.Choices, ", "))
+	}
+
+	if o.Pattern != "" {
+		if re, err := regexp.Compile(o.Pattern); err == nil && !re.MatchString(value) {
+			return fmt.Errorf("must match pattern %s", o.Pattern)
+		}
+	}
+
+	if o.Min != nil || o.Max != nil {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a valid number")
+		}
+		if o.Min != nil && n < *o.Min {
+			return fmt.Errorf("must be at least %v", *o.Min)
+		}
+		if o.Max != nil && n > *o.Max {
+			return fmt.Errorf("must be at most %v", *o.Max)
+		}
+	}
+
+	return nil
+}
+
+// hasChoice compares numbers by value so 1.50 matches the choice 1.5
+func (o Option) hasChoice(value string) bool {
+	for _, choice := range o.Choices {
+		if choice == value {
+			return true
+		}
+		if o.Type == "int" || o.Type == "float" {
+			a, errA := strconv.ParseFloat(choice, 64)
+			b, errB := strconv.ParseFloat(value, 64)
+			if errA == nil && errB == nil && a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Test version validation
@@ -11,8 +13,9 @@ func TestVersionValidation(t *testing.T) {
 		valid   bool
 	}{
 		{1, true},
+		{2, true},
 		{0, false},
-		{2, false},
+		{3, false},
 		{-1, false},
 	}
 
@@ -65,7 +68,7 @@ func TestVariableNameValidation(t *testing.T) {
 
 // Test option type validation
 func TestOptionTypeValidation(t *testing.T) {
-	validTestTypes := []string{"bool", "str", "int", "float"}
+	validTestTypes := []string{"bool", "str", "int", "float", "path", "file", "dir", "duration", "count"}
 	invalidTestTypes := []string{"string", "boolean", "number", "invalid", ""}
 
 	for _, optType := range validTestTypes {
@@ -104,6 +107,7 @@ func TestShorthandValidation(t *testing.T) {
 		{"-", false},
 		{"h", false}, // reserved
 		{"i", false}, // reserved
+		{"j", false}, // reserved
 	}
 
 	for _, tt := range tests {
@@ -197,3 +201,890 @@ func TestDuplicateShorthands(t *testing.T) {
 		t.Error("Expected error for duplicate shorthands")
 	}
 }
+
+func TestPassthroughReservesArgsVar(t *testing.T) {
+	cmd := Command{
+		Name:        "test",
+		Passthrough: true,
+		Options: []Option{
+			{Name: "args", Type: "str"},
+		},
+		Script: "echo test",
+	}
+
+	if err := validateCommand(cmd); err == nil {
+		t.Error("Expected error for option using reserved var name 'args'")
+	}
+
+	cmd.Passthrough = false
+	if err := validateCommand(cmd); err != nil {
+		t.Errorf("Expected 'args' to be allowed without passthrough, got error: %v", err)
+	}
+}
+
+// Test env var name validation
+func TestOptionEnvValidation(t *testing.T) {
+	tests := []struct {
+		env   string
+		valid bool
+	}{
+		{"", true}, // empty is ok (optional)
+		{"DEPLOY_TAG", true},
+		{"_PRIVATE", true},
+		{"deploy_tag", true},
+		{"1TAG", false},
+		{"DEPLOY-TAG", false},
+		{"$DEPLOY_TAG", false},
+	}
+
+	for _, tt := range tests {
+		t.Run("Env: "+tt.env, func(t *testing.T) {
+			opt := Option{Name: "test", Type: "str", Env: tt.env}
+			err := validateOption(opt)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected env '%s' to be valid, got error: %v", tt.env, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected env '%s' to be invalid, got no error", tt.env)
+			}
+		})
+	}
+}
+
+// Test path option constraints
+func TestPathOptionValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   Option
+		valid bool
+	}{
+		{"file with extensions", Option{Name: "dump", Type: "file", MustExist: true, Extensions: []string{".sql", ".tar.gz"}}, true},
+		{"path with extensions", Option{Name: "dump", Type: "path", Extensions: []string{".yaml"}}, true},
+		{"dir must exist", Option{Name: "out", Type: "dir", MustExist: true}, true},
+		{"dir with extensions", Option{Name: "out", Type: "dir", Extensions: []string{".sql"}}, false},
+		{"str must exist", Option{Name: "name", Type: "str", MustExist: true}, false},
+		{"str with extensions", Option{Name: "name", Type: "str", Extensions: []string{".sql"}}, false},
+		{"extension without dot", Option{Name: "dump", Type: "file", Extensions: []string{"sql"}}, false},
+		{"extension only dot", Option{Name: "dump", Type: "file", Extensions: []string{"."}}, false},
+		{"extension with separator", Option{Name: "dump", Type: "file", Extensions: []string{"./sql"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOption(tt.opt)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected option to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected option to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test that only string options can be secret
+func TestSecretOptionValidation(t *testing.T) {
+	if err := validateOption(Option{Name: "password", Type: "str", Secret: true}); err != nil {
+		t.Errorf("Expected secret str option to be valid, got error: %v", err)
+	}
+
+	if err := validateOption(Option{Name: "force", Type: "bool", Secret: true}); err == nil {
+		t.Error("Expected secret bool option to be invalid, got no error")
+	}
+}
+
+// Test option relationship references
+func TestOptionRelationsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		valid   bool
+	}{
+		{
+			name: "valid references",
+			options: []Option{
+				{Name: "all", Type: "bool", ConflictsWith: []string{"service"}},
+				{Name: "service", Type: "str"},
+				{Name: "push", Type: "bool", Requires: []string{"registry"}},
+				{Name: "registry", Type: "str", RequiredIf: map[string]string{"push": "true"}},
+			},
+			valid: true,
+		},
+		{
+			name:    "unknown conflicts_with",
+			options: []Option{{Name: "all", Type: "bool", ConflictsWith: []string{"service"}}},
+			valid:   false,
+		},
+		{
+			name:    "unknown requires",
+			options: []Option{{Name: "push", Type: "bool", Requires: []string{"registry"}}},
+			valid:   false,
+		},
+		{
+			name:    "unknown required_if",
+			options: []Option{{Name: "registry", Type: "str", RequiredIf: map[string]string{"push": "true"}}},
+			valid:   false,
+		},
+		{
+			name:    "self reference",
+			options: []Option{{Name: "all", Type: "bool", ConflictsWith: []string{"all"}}},
+			valid:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command{Name: "test", Options: tt.options, Script: "echo test"}
+			err := validateCommand(cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected command to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected command to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test dynamic completion settings
+func TestCompleteValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   Option
+		valid bool
+	}{
+		{"str with complete", Option{Name: "container", Type: "str", Complete: "docker ps --format '{{.Names}}'"}, true},
+		{"with timeout", Option{Name: "branch", Type: "str", Complete: "git branch --format '%(refname:short)'", CompleteTimeout: "2s"}, true},
+		{"bool with complete", Option{Name: "force", Type: "bool", Complete: "echo true"}, false},
+		{"file with complete", Option{Name: "dump", Type: "file", Complete: "ls"}, false},
+		{"timeout without complete", Option{Name: "container", Type: "str", CompleteTimeout: "2s"}, false},
+		{"invalid timeout", Option{Name: "container", Type: "str", Complete: "ls", CompleteTimeout: "soon"}, false},
+		{"zero timeout", Option{Name: "container", Type: "str", Complete: "ls", CompleteTimeout: "0s"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOption(tt.opt)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected option to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected option to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test default values against option types
+func TestDefaultValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   Option
+		valid bool
+	}{
+		{"bool true", Option{Name: "cache", Type: "bool", Default: "true"}, true},
+		{"bool invalid", Option{Name: "cache", Type: "bool", Default: "yes"}, false},
+		{"int", Option{Name: "replicas", Type: "int", Default: "3"}, true},
+		{"int invalid", Option{Name: "replicas", Type: "int", Default: "three"}, false},
+		{"float", Option{Name: "ratio", Type: "float", Default: "0.5"}, true},
+		{"float invalid", Option{Name: "ratio", Type: "float", Default: "half"}, false},
+		{"duration", Option{Name: "timeout", Type: "duration", Default: "30s"}, true},
+		{"duration invalid", Option{Name: "timeout", Type: "duration", Default: "30"}, false},
+		{"count", Option{Name: "verbose", Type: "count", Default: "1"}, true},
+		{"count negative", Option{Name: "verbose", Type: "count", Default: "-1"}, false},
+		{"str", Option{Name: "env", Type: "str", Default: "staging"}, true},
+		{"mandatory with default", Option{Name: "env", Type: "str", Default: "staging", Mandatory: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOption(tt.opt)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected option to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected option to be invalid, got no error")
+			}
+		})
+	}
+}
+
+func TestNegationNameConflict(t *testing.T) {
+	cmd := Command{
+		Name: "test",
+		Options: []Option{
+			{Name: "cache", Type: "bool", Default: "true"},
+			{Name: "no-cache", Type: "bool"},
+		},
+		Script: "echo test",
+	}
+
+	if err := validateCommand(cmd); err == nil {
+		t.Error("Expected error for option clashing with generated --no-cache flag")
+	}
+
+	cmd.Options[0].Default = "false"
+	if err := validateCommand(cmd); err != nil {
+		t.Errorf("Expected no clash without default true, got error: %v", err)
+	}
+}
+
+// Test that options cannot shadow built-in flags
+func TestReservedOptionNames(t *testing.T) {
+	for _, opt := range []Option{
+		{Name: "jobs", Type: "int"},
+		{Name: "keep-going", Type: "bool"},
+		{Name: "parallel", Type: "int", Aliases: []string{"jobs"}},
+	} {
+		cmd := Command{Name: "test", Options: []Option{opt}, Script: "echo test"}
+		if err := validateCommand(cmd); err == nil {
+			t.Errorf("Expected error for option %+v using a reserved name", opt)
+		}
+	}
+
+	// Command options can take over some built-in flags, global options cannot
+	cmd := Command{Name: "deploy", Options: []Option{{Name: "force", Type: "str"}, {Name: "watch", Type: "bool"}, {Name: "timeout", Type: "duration"}}, Script: "echo test"}
+	if err := validateCommand(cmd); err != nil {
+		t.Errorf("Expected command option to shadow --force, got error: %v", err)
+	}
+	config := &Config{Version: 1, Options: []Option{{Name: "force", Type: "bool"}}, Commands: []Command{{Name: "test", Script: "echo test"}}}
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for a global option named force")
+	}
+}
+
+// Test option alias validation and conflicts
+func TestOptionAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		valid   bool
+	}{
+		{
+			name:    "valid aliases",
+			options: []Option{{Name: "env", Type: "str", Aliases: []string{"environment", "stage"}}},
+			valid:   true,
+		},
+		{
+			name:    "invalid alias",
+			options: []Option{{Name: "env", Type: "str", Aliases: []string{"bad alias"}}},
+			valid:   false,
+		},
+		{
+			name:    "alias equal to own name",
+			options: []Option{{Name: "env", Type: "str", Aliases: []string{"env"}}},
+			valid:   false,
+		},
+		{
+			name: "alias clashes with other option",
+			options: []Option{
+				{Name: "env", Type: "str", Aliases: []string{"stage"}},
+				{Name: "stage", Type: "str"},
+			},
+			valid: false,
+		},
+		{
+			name: "alias clashes with other alias",
+			options: []Option{
+				{Name: "env", Type: "str", Aliases: []string{"target"}},
+				{Name: "host", Type: "str", Aliases: []string{"target"}},
+			},
+			valid: false,
+		},
+		{
+			name: "alias negation clashes with other option",
+			options: []Option{
+				{Name: "cache", Type: "bool", Default: "true", Aliases: []string{"use-cache"}},
+				{Name: "no-use-cache", Type: "bool"},
+			},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command{Name: "test", Options: tt.options, Script: "echo test"}
+			err := validateCommand(cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected command to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected command to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test user-defined option types
+func TestOptionTypeDefinitions(t *testing.T) {
+	min, max := 1.0, 10.0
+	tests := []struct {
+		name  string
+		t     OptionType
+		valid bool
+	}{
+		{"pattern", OptionType{Name: "semver", Base: "str", Pattern: `^v?\d+\.\d+\.\d+$`}, true},
+		{"choices", OptionType{Name: "env", Base: "str", Choices: []string{"dev", "prod"}}, true},
+		{"bounds", OptionType{Name: "replicas", Base: "int", Min: &min, Max: &max}, true},
+		{"complete", OptionType{Name: "namespace", Base: "str", Complete: "kubectl get ns -o name"}, true},
+		{"unknown base", OptionType{Name: "semver", Base: "string"}, false},
+		{"custom base", OptionType{Name: "semver", Base: "version"}, false},
+		{"builtin name", OptionType{Name: "str", Base: "str"}, false},
+		{"invalid name", OptionType{Name: "sem ver", Base: "str"}, false},
+		{"invalid pattern", OptionType{Name: "semver", Base: "str", Pattern: "("}, false},
+		{"pattern on int", OptionType{Name: "port", Base: "int", Pattern: "^8"}, false},
+		{"invalid int choice", OptionType{Name: "port", Base: "int", Choices: []string{"80", "http"}}, false},
+		{"bounds on str", OptionType{Name: "name", Base: "str", Min: &min}, false},
+		{"min above max", OptionType{Name: "replicas", Base: "int", Min: &max, Max: &min}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOptionType(tt.t)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected type to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected type to be invalid, got no error")
+			}
+		})
+	}
+}
+
+func TestOptionTypeResolution(t *testing.T) {
+	config := &Config{
+		Version: 1,
+		Types: []OptionType{
+			{Name: "env", Base: "str", Choices: []string{"dev", "prod"}},
+		},
+		Commands: []Command{{
+			Name: "deploy",
+			Options: []Option{
+				{Name: "target", Type: "env", Default: "prod"},
+				{Name: "other", Type: "env", Choices: []string{"qa"}, Default: "qa"},
+			},
+			Script: "echo test",
+		}},
+	}
+
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("Expected config to be valid, got error: %v", err)
+	}
+
+	target := config.Commands[0].Options[0]
+	if target.Type != "str" || len(target.Choices) != 2 {
+		t.Errorf("Expected option to inherit base type and choices, got: %+v", target)
+	}
+
+	other := config.Commands[0].Options[1]
+	if len(other.Choices) != 1 || other.Choices[0] != "qa" {
+		t.Errorf("Expected option choices to override type choices, got: %v", other.Choices)
+	}
+
+	config.Commands[0].Options[0] = Option{Name: "target", Type: "env", Default: "staging"}
+	config.Commands[0].Options[1] = Option{Name: "other", Type: "env"}
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for default outside of type choices")
+	}
+}
+
+// Test value checks against choices, pattern and bounds
+func TestCheckValue(t *testing.T) {
+	min, max := 1.0, 10.0
+	tests := []struct {
+		opt   Option
+		value string
+		valid bool
+	}{
+		{Option{Type: "str", Choices: []string{"dev", "prod"}}, "prod", true},
+		{Option{Type: "str", Choices: []string{"dev", "prod"}}, "qa", false},
+		{Option{Type: "float", Choices: []string{"1.5", "2"}}, "1.50", true},
+		{Option{Type: "str", Pattern: `^v\d+$`}, "v2", true},
+		{Option{Type: "str", Pattern: `^v\d+$`}, "2", false},
+		{Option{Type: "int", Min: &min, Max: &max}, "10", true},
+		{Option{Type: "int", Min: &min, Max: &max}, "0", false},
+		{Option{Type: "int", Min: &min, Max: &max}, "11", false},
+	}
+
+	for _, tt := range tests {
+		err := tt.opt.CheckValue(tt.value)
+
+		if tt.valid && err != nil {
+			t.Errorf("Expected %q to be valid, got error: %v", tt.value, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected %q to be invalid, got no error", tt.value)
+		}
+	}
+}
+
+// Test option set splicing and overrides
+func TestOptionSets(t *testing.T) {
+	config := &Config{
+		Version: 1,
+		OptionSets: map[string][]Option{
+			"docker": {
+				{Name: "registry", Type: "str", Default: "docker.io"},
+				{Name: "tag", Type: "str", Mandatory: true},
+			},
+		},
+		Commands: []Command{{
+			Name:       "build",
+			UseOptions: []string{"docker"},
+			Options: []Option{
+				{Name: "push", Type: "bool"},
+				{Name: "registry", Default: "ghcr.io"},
+			},
+			Script: "echo test",
+		}},
+	}
+
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("Expected config to be valid, got error: %v", err)
+	}
+
+	options := config.Commands[0].Options
+	var names []string
+	for _, opt := range options {
+		names = append(names, opt.Name)
+	}
+	if len(names) != 3 || names[0] != "registry" || names[1] != "tag" || names[2] != "push" {
+		t.Fatalf("Expected options [registry tag push], got: %v", names)
+	}
+
+	if options[0].Type != "str" || options[0].Default != "ghcr.io" {
+		t.Errorf("Expected registry override to keep type and replace default, got: %+v", options[0])
+	}
+
+	// Validating again must not splice the set twice
+	if err := validateConfig(config); err != nil {
+		t.Errorf("Expected revalidation to succeed, got error: %v", err)
+	}
+}
+
+// Test that overrides written in a Kookfile can reset set option fields
+func TestOptionSetOverrides(t *testing.T) {
+	data := `
+version: 1
+option_sets:
+  docker:
+    - name: registry
+      type: str
+      mandatory: true
+    - name: tag
+      type: str
+      mandatory: true
+      secret: true
+commands:
+  - name: build
+    use_options: [docker]
+    options:
+      - name: registry
+        default: ghcr.io
+      - name: tag
+        mandatory: false
+        secret: false
+    script: echo test
+`
+	var config Config
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Expected config to be valid, got error: %v", err)
+	}
+
+	options := config.Commands[0].Options
+	if options[0].Default != "ghcr.io" || options[0].Mandatory {
+		t.Errorf("Expected registry default to make it optional, got: %+v", options[0])
+	}
+	if options[1].Type != "str" || options[1].Mandatory || options[1].Secret {
+		t.Errorf("Expected tag override to reset mandatory and secret, got: %+v", options[1])
+	}
+}
+
+func TestOptionSetErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		sets       map[string][]Option
+		useOptions []string
+	}{
+		{
+			name:       "unknown set",
+			sets:       map[string][]Option{},
+			useOptions: []string{"docker"},
+		},
+		{
+			name: "duplicate option across sets",
+			sets: map[string][]Option{
+				"docker": {{Name: "tag", Type: "str"}},
+				"helm":   {{Name: "tag", Type: "str"}},
+			},
+			useOptions: []string{"docker", "helm"},
+		},
+		{
+			name:       "invalid option in unused set",
+			sets:       map[string][]Option{"docker": {{Name: "tag", Type: "string"}}},
+			useOptions: nil,
+		},
+		{
+			name:       "invalid set name",
+			sets:       map[string][]Option{"bad set": {{Name: "tag", Type: "str"}}},
+			useOptions: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Version:    1,
+				OptionSets: tt.sets,
+				Commands:   []Command{{Name: "build", UseOptions: tt.useOptions, Script: "echo test"}},
+			}
+
+			if err := validateConfig(config); err == nil {
+				t.Error("Expected config to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test global options shared by all commands
+func TestGlobalOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  []Option
+		command []Option
+		valid   bool
+	}{
+		{
+			name:    "distinct options",
+			global:  []Option{{Name: "profile", Type: "str"}},
+			command: []Option{{Name: "tag", Type: "str", Requires: []string{"profile"}}},
+			valid:   true,
+		},
+		{
+			name:   "invalid global option",
+			global: []Option{{Name: "profile", Type: "string"}},
+			valid:  false,
+		},
+		{
+			name:    "name clash",
+			global:  []Option{{Name: "verbose", Type: "bool"}},
+			command: []Option{{Name: "verbose", Type: "bool"}},
+			valid:   false,
+		},
+		{
+			name:    "alias clash",
+			global:  []Option{{Name: "dry", Type: "bool", Aliases: []string{"dry-run"}}},
+			command: []Option{{Name: "dry-run", Type: "bool"}},
+			valid:   false,
+		},
+		{
+			name:    "shorthand clash",
+			global:  []Option{{Name: "verbose", Shorthand: "v", Type: "bool"}},
+			command: []Option{{Name: "version", Shorthand: "v", Type: "str"}},
+			valid:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Version:  1,
+				Options:  tt.global,
+				Commands: []Command{{Name: "deploy", Options: tt.command, Script: "echo test"}},
+			}
+			err := validateConfig(config)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected config to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected config to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test command dependencies
+func TestDepsValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []Command
+		valid    bool
+	}{
+		{
+			name: "valid deps",
+			commands: []Command{
+				{Name: "lint", Aliases: []string{"l"}, Script: "echo lint"},
+				{Name: "build", Deps: []string{"l"}, Script: "echo build"},
+				{Name: "deploy", Deps: []string{"lint", "build --target='prod env'"}, Script: "echo deploy"},
+			},
+			valid: true,
+		},
+		{
+			name:     "unknown command",
+			commands: []Command{{Name: "deploy", Deps: []string{"build"}, Script: "echo deploy"}},
+			valid:    false,
+		},
+		{
+			name:     "empty dep",
+			commands: []Command{{Name: "deploy", Deps: []string{" "}, Script: "echo deploy"}},
+			valid:    false,
+		},
+		{
+			name:     "unbalanced quotes",
+			commands: []Command{{Name: "deploy", Deps: []string{"deploy --tag 'v1"}, Script: "echo deploy"}},
+			valid:    false,
+		},
+		{
+			name:     "self dependency",
+			commands: []Command{{Name: "deploy", Deps: []string{"deploy"}, Script: "echo deploy"}},
+			valid:    false,
+		},
+		{
+			name: "cycle through alias",
+			commands: []Command{
+				{Name: "build", Aliases: []string{"b"}, Deps: []string{"test"}, Script: "echo build"},
+				{Name: "test", Deps: []string{"b"}, Script: "echo test"},
+			},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Version: 1, Commands: tt.commands}
+			err := validateConfig(config)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected config to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected config to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test sources and generates validation
+func TestSourcesValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   Command
+		valid bool
+	}{
+		{"sources only", Command{Sources: []string{"**/*.go", "go.mod"}}, true},
+		{"sources and generates", Command{Sources: []string{"src/**"}, Generates: []string{"dist/app"}}, true},
+		{"generates without sources", Command{Generates: []string{"dist/app"}}, false},
+		{"invalid source pattern", Command{Sources: []string{"src/[a-"}}, false},
+		{"invalid generates pattern", Command{Sources: []string{"src/**"}, Generates: []string{"dist/{a,b"}}, false},
+		{"watch patterns", Command{Watch: []string{"**/*.go", "templates/*.html"}}, true},
+		{"invalid watch pattern", Command{Watch: []string{"[z-a"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cmd.Name = "build"
+			tt.cmd.Script = "echo build"
+			err := validateCommand(tt.cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected command to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected command to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test command timeout validation
+func TestCommandTimeoutValidation(t *testing.T) {
+	tests := []struct {
+		timeout string
+		valid   bool
+	}{
+		{"", true},
+		{"30s", true},
+		{"1h30m", true},
+		{"0s", false},
+		{"-5m", false},
+		{"10", false},
+		{"soon", false},
+	}
+
+	for _, tt := range tests {
+		t.Run("Timeout: "+tt.timeout, func(t *testing.T) {
+			cmd := Command{Name: "test", Script: "echo test", Timeout: tt.timeout}
+			err := validateCommand(cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected timeout '%s' to be valid, got error: %v", tt.timeout, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected timeout '%s' to be invalid, got no error", tt.timeout)
+			}
+		})
+	}
+}
+
+// Test retry validation
+func TestRetryValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry Retry
+		valid bool
+	}{
+		{"attempts only", Retry{Attempts: 3}, true},
+		{"full", Retry{Attempts: 3, Delay: "2s", Backoff: "exponential", OnExitCodes: []int{1, 75}}, true},
+		{"constant backoff", Retry{Attempts: 2, Backoff: "constant"}, true},
+		{"no attempts", Retry{}, false},
+		{"invalid delay", Retry{Attempts: 3, Delay: "soon"}, false},
+		{"negative delay", Retry{Attempts: 3, Delay: "-1s"}, false},
+		{"invalid backoff", Retry{Attempts: 3, Backoff: "linear"}, false},
+		{"invalid exit code", Retry{Attempts: 3, OnExitCodes: []int{0}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command{Name: "test", Script: "echo test", Retry: &tt.retry}
+			err := validateCommand(cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected retry to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected retry to be invalid, got no error")
+			}
+		})
+	}
+
+	retry := Retry{Attempts: 3, OnExitCodes: []int{75}}
+	if !retry.RetriesOn(75) || retry.RetriesOn(1) {
+		t.Error("Expected only listed exit codes to be retried")
+	}
+	if !(Retry{Attempts: 3}).RetriesOn(1) {
+		t.Error("Expected any exit code to be retried without on_exit_codes")
+	}
+}
+
+// Test working directory settings
+func TestWorkingDirValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"default dir kookfile", Config{DefaultDir: "kookfile"}, true},
+		{"default dir invocation", Config{DefaultDir: "invocation"}, true},
+		{"invalid default dir", Config{DefaultDir: "home"}, false},
+		{"templated command dir", Config{Commands: []Command{{Name: "migrate", Dir: "db/{{ .env }}", Script: "echo"}}}, true},
+		{"invalid command dir template", Config{Commands: []Command{{Name: "migrate", Dir: "db/{{ .env", Script: "echo"}}}, false},
+		{"reserved variable", Config{Variables: []Variable{{Name: "kookfile_dir", Value: "x"}}}, false},
+		{"reserved option var", Config{Commands: []Command{{Name: "test", Script: "echo", Options: []Option{{Name: "invocation-dir", Type: "str"}}}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Version = 1
+			if len(config.Commands) == 0 {
+				config.Commands = []Command{{Name: "test", Script: "echo test"}}
+			}
+			err := validateConfig(&config)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected config to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected config to be invalid, got no error")
+			}
+		})
+	}
+}
+
+// Test environment settings validation
+func TestEnvValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmd   Command
+		valid bool
+	}{
+		{"env values", Command{Env: map[string]string{"STAGE": "{{ .env }}", "_DEBUG": "1"}}, true},
+		{"hermetic", Command{EnvClear: true, EnvPassthrough: []string{"PATH", "HOME"}}, true},
+		{"invalid env name", Command{Env: map[string]string{"MY-VAR": "1"}}, false},
+		{"invalid env template", Command{Env: map[string]string{"STAGE": "{{ .env"}}, false},
+		{"invalid passthrough name", Command{EnvPassthrough: []string{"1PATH"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cmd.Name = "test"
+			tt.cmd.Script = "echo test"
+			err := validateCommand(tt.cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected command to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected command to be invalid, got no error")
+			}
+		})
+	}
+
+	config := &Config{Version: 1, Env: map[string]string{"bad name": "1"}, Commands: []Command{{Name: "test", Script: "echo test"}}}
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for invalid top-level env name")
+	}
+}
+
+// Test container settings validation
+func TestContainerValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		container Container
+		valid     bool
+	}{
+		{"image only", Container{Image: "golang:1.22"}, true},
+		{"full", Container{Image: "golang:{{ .go }}", Engine: "podman", Volumes: []string{"./cache:/cache", "gomod:/go/pkg/mod:ro"}, Workdir: "/src", Env: map[string]string{"CGO_ENABLED": "0"}}, true},
+		{"no image", Container{Workdir: "/src"}, false},
+		{"invalid image template", Container{Image: "golang:{{ .go"}, false},
+		{"invalid engine", Container{Image: "golang:1.22", Engine: "lxc"}, false},
+		{"relative workdir", Container{Image: "golang:1.22", Workdir: "src"}, false},
+		{"invalid volume", Container{Image: "golang:1.22", Volumes: []string{"/cache"}}, false},
+		{"invalid env name", Container{Image: "golang:1.22", Env: map[string]string{"MY-VAR": "1"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command{Name: "test", Script: "echo test", Container: &tt.container}
+			err := validateCommand(cmd)
+
+			if tt.valid && err != nil {
+				t.Errorf("Expected container to be valid, got error: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected container to be invalid, got no error")
+			}
+		})
+	}
+
+	config := &Config{Version: 1, Commands: []Command{{Name: "test", Script: "echo test", Shell: Shell{"builtin"}, Container: &Container{Image: "alpine"}}}}
+	if err := validateConfig(config); err == nil {
+		t.Error("Expected error for a container command using the builtin shell")
+	}
+
+	config = &Config{Version: 1, Shell: Shell{"builtin"}, Commands: []Command{{Name: "test", Script: "echo test", Container: &Container{Image: "alpine"}}}}
+	if err := validateConfig(config); err != nil {
+		t.Errorf("Expected the top-level builtin shell not to apply to containers, got error: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// exitError is a script failure with an exit code, reported by the embedded
+// shell the same way as the failure of a script process
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// ExitCode returns the exit code of the script
+func (e *exitError) ExitCode() int {
+	return e.code
+}
+
+// runBuiltin runs the script with the embedded shell, in the directory and
+// environment of spec and with the command's standard streams
+func runBuiltin(ctx context.Context, cobraCmd *cobra.Command, name string, spec runSpec) error {
+	file, err := syntax.NewParser().Parse(strings.NewReader(spec.script), name)
+	if err != nil {
+		return fmt.Errorf("failed to parse script: %w", err)
+	}
+
+	env := spec.env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	runner, err := interp.New(
+		interp.Dir(spec.dir),
+		interp.Env(expand.ListEnviron(env...)),
+		interp.StdIO(cobraCmd.InOrStdin(), cobraCmd.OutOrStdout(), cobraCmd.ErrOrStderr()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start builtin shell: %w", err)
+	}
+
+	err = runner.Run(ctx, file)
+	if status, ok := interp.IsExitStatus(err); ok {
+		return &exitError{code: int(status)}
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// containerEngines are the engines tried, in order, when a container does
+// not name one
+var containerEngines = []string{"docker", "podman"}
+
+// containerHome is the home directory of scripts run as the current user,
+// who usually has none in the image
+const containerHome = "/tmp"
+
+// containerArgs wraps the command line running a script so that it runs in
+// the command's container. The Kookfile directory is mounted at the
+// container's workdir (by default its own path, so resolved path options stay
+// valid), and the script runs as the current user in the matching directory.
+// The result always starts with the engine and "run".
+func containerArgs(cfg *config.Config, cmd config.Command, ctx map[string]interface{}, dir string, shell config.Shell, args []string, stdin io.Reader) ([]string, error) {
+	container := cmd.Container
+
+	engine, err := containerEngine(container.Engine)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := renderContainerImage(cmd.Name, container.Image, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	run := []string{engine, "run", "--rm", "-i"}
+	if isTerminal(stdin) {
+		run = append(run, "-t")
+	}
+	// An init process passes signals on to the script
+	run = append(run, "--init")
+
+	// Files created in the project belong to the user, not to root. Root
+	// keeps the image's root user and its home.
+	uid := os.Getuid()
+	mapUser := uid > 0
+	if mapUser {
+		if filepath.Base(engine) == "podman" {
+			run = append(run, "--userns=keep-id")
+		} else {
+			run = append(run, "--user", fmt.Sprintf("%d:%d", uid, os.Getgid()))
+		}
+	}
+
+	workdir := container.Workdir
+	if workdir == "" {
+		workdir = filepath.ToSlash(cfg.Dir)
+	}
+	run = append(run, "-v", cfg.Dir+":"+workdir)
+
+	// Scripts passed as a file need the file in the container too
+	if _, inline := inlineFlag(shell); !inline {
+		file := args[len(args)-1]
+		run = append(run, "-v", file+":"+filepath.ToSlash(file)+":ro")
+	}
+
+	for _, volume := range container.Volumes {
+		run = append(run, "-v", resolveVolume(cfg, volume))
+	}
+
+	cwd := workdir
+	if rel, err := filepath.Rel(cfg.Dir, dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		cwd = path.Join(workdir, filepath.ToSlash(rel))
+	}
+	run = append(run, "-w", cwd)
+
+	// The container gets the configured environment only, plus the
+	// variables listed in env_passthrough
+	passthrough := append(append([]string{}, cfg.EnvPassthrough...), cmd.EnvPassthrough...)
+	env, err := renderEnv(ctx, cfg.Env, cmd.Env, container.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a home, tools caching there (go build, npm) fail
+	if mapUser && !setsEnv("HOME", passthrough, env) {
+		run = append(run, "-e", "HOME="+containerHome)
+	}
+	for _, name := range passthrough {
+		run = append(run, "-e", name)
+	}
+	for _, entry := range env {
+		run = append(run, "-e", entry)
+	}
+
+	run = append(run, image)
+	return append(run, args...), nil
+}
+
+// runContainer runs a script in its container under a unique name, and kills
+// the container when the script is stopped: signals only reach the engine
+// client, which may itself be killed before the container exits
+func runContainer(ctx context.Context, cobraCmd *cobra.Command, name string, spec runSpec) error {
+	containerName, err := newContainerName(name)
+	if err != nil {
+		return err
+	}
+	spec.args = append([]string{spec.args[0], spec.args[1], "--name", containerName}, spec.args[2:]...)
+
+	err = runProcess(ctx, cobraCmd, spec)
+	if ctx.Err() != nil {
+		killCtx, cancel := context.WithTimeout(context.Background(), killGracePeriod)
+		defer cancel()
+		exec.CommandContext(killCtx, spec.args[0], "kill", containerName).Run()
+	}
+	return err
+}
+
+func newContainerName(name string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to name container: %w", err)
+	}
+	return "kook-" + name + "-" + hex.EncodeToString(suffix), nil
+}
+
+// setsEnv reports whether a variable is passed through or set in env
+func setsEnv(name string, passthrough, env []string) bool {
+	for _, passed := range passthrough {
+		if passed == name {
+			return true
+		}
+	}
+	for _, entry := range env {
+		if strings.HasPrefix(entry, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// containerEngine returns the path of the engine running containers: the
+// given one, or the first of docker and podman found
+func containerEngine(name string) (string, error) {
+	if name != "" {
+		enginePath, err := exec.LookPath(name)
+		if err != nil {
+			return "", fmt.Errorf("container engine '%s' not found", name)
+		}
+		return enginePath, nil
+	}
+
+	for _, engine := range containerEngines {
+		if enginePath, err := exec.LookPath(engine); err == nil {
+			return enginePath, nil
+		}
+	}
+	return "", fmt.Errorf("no container engine found: install docker or podman")
+}
+
+func renderContainerImage(name, image string, ctx map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name + " image").Parse(image)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse container image template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return "", fmt.Errorf("failed to execute container image template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// resolveVolume makes the host side of a bind mount absolute: paths starting
+// with "." are relative to the Kookfile and "~/" to the home directory. Named
+// volumes are left as is.
+func resolveVolume(cfg *config.Config, volume string) string {
+	host, rest, _ := strings.Cut(volume, ":")
+
+	switch {
+	case strings.HasPrefix(host, "~/"):
+		if home, err := os.UserHomeDir(); err == nil {
+			host = filepath.Join(home, host[2:])
+		}
+	case strings.HasPrefix(host, "."):
+		host = cfg.ResolvePath(host)
+	}
+
+	return host + ":" + rest
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
@@ -2,16 +2,84 @@ package executor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 	"text/template"
+	"time"
 
 	"kook/internal/config"
 
+	"github.com/kballard/go-shellquote"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// Duration is the value of a duration option. It renders as written on the
+// command line ({{ .timeout }}) and converts to other units for tools that
+// expect plain numbers ({{ .timeout.Seconds }}, {{ .timeout.Milliseconds }}).
+type Duration string
+
+// Seconds returns the duration as a floating point number of seconds
+func (d Duration) Seconds() float64 {
+	v, _ := time.ParseDuration(string(d))
+	return v.Seconds()
+}
+
+// Milliseconds returns the duration as an integer number of milliseconds
+func (d Duration) Milliseconds() int64 {
+	v, _ := time.ParseDuration(string(d))
+	return v.Milliseconds()
+}
+
+// Count is the value of a count option. It renders as a number
+// ({{ .verbose }}) and can rebuild repeated flags for other tools
+// ({{ if .verbose }}-{{ .verbose.Repeat "v" }}{{ end }} gives -vvv).
+type Count int
+
+// Repeat returns s repeated as many times as the count
+func (c Count) Repeat(s string) string {
+	if c <= 0 {
+		return ""
+	}
+	return strings.Repeat(s, int(c))
+}
+
+// Args holds the arguments passed after "--" to a passthrough command.
+// It renders as a shell-quoted string in templates ({{ .args }}) and can
+// still be ranged over or indexed to access the raw values.
+type Args []string
+
+func (a Args) String() string {
+	return shellquote.Join(a...)
+}
+
+// killGracePeriod is how long a stopped script has to exit after SIGTERM
+// before it is killed
+const killGracePeriod = 5 * time.Second
+
+// TimeoutExitCode is the exit code of kook when a command times out, the
+// same as timeout(1)
+const TimeoutExitCode = 124
+
+// TimeoutError is returned when a script runs longer than its timeout
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command '%s' timed out after %s", e.Command, e.Timeout)
+}
+
+var errInterrupted = errors.New("interrupted")
+
 // Execute runs a command with the given configuration and cobra command
 func Execute(cfg *config.Config, cmd config.Command, cobraCmd *cobra.Command) error {
 	// Build template context with variables and options
@@ -22,13 +90,35 @@ func Execute(cfg *config.Config, cmd config.Command, cobraCmd *cobra.Command) er
 		ctx[k] = v
 	}
 
+	// Add the directories commands can run from
+	invocationDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	ctx["kookfile_dir"] = cfg.Dir
+	ctx["invocation_dir"] = invocationDir
+
 	// Add all option values using their var names
+	var secrets []string
+	values := make(map[string]string)
 	for _, opt := range cmd.Options {
-		val, err := getOptionValue(cobraCmd, opt)
+		val, err := getOptionValue(cfg, cobraCmd, opt)
 		if err != nil {
 			return fmt.Errorf("failed to get option '%s': %w", opt.Name, err)
 		}
 		ctx[opt.GetVarName()] = val
+		values[opt.Name] = fmt.Sprint(val)
+
+		if opt.Secret {
+			if str, ok := val.(string); ok && str != "" {
+				secrets = append(secrets, str)
+			}
+		}
+	}
+
+	// Add extra arguments given after "--"
+	if cmd.Passthrough {
+		ctx["args"] = passthroughArgs(cobraCmd)
 	}
 
 	// Parse and execute template
@@ -44,31 +134,346 @@ func Execute(cfg *config.Config, cmd config.Command, cobraCmd *cobra.Command) er
 
 	scriptCmd := buf.String()
 
+	// Skip commands whose sources, script and options are unchanged
+	var sum string
+	if len(cmd.Sources) > 0 {
+		sum, err = fingerprint(cfg, cmd, scriptCmd, values)
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint sources: %w", err)
+		}
+
+		force := BuiltinBool(cobraCmd, "force")
+		upToDate, err := isUpToDate(cfg, cmd, sum)
+		if err != nil {
+			return fmt.Errorf("failed to check sources: %w", err)
+		}
+		if upToDate && !force {
+			if !cmd.Silent {
+				fmt.Fprintf(cobraCmd.OutOrStdout(), "Skipping %s: up to date\n", cmd.Name)
+			}
+			return nil
+		}
+	}
+
 	// Print execution message unless silent mode is enabled
 	if !cmd.Silent {
-		fmt.Printf("Executing: %s\n", scriptCmd)
+		fmt.Fprintf(cobraCmd.OutOrStdout(), "Executing: %s\n", redact(scriptCmd, secrets))
+	}
+
+	dir, err := commandDir(cfg, cmd, ctx, invocationDir)
+	if err != nil {
+		return err
+	}
+
+	env, err := commandEnv(cfg, cmd, ctx)
+	if err != nil {
+		return err
 	}
 
-	// Execute the command using bash
-	bashCmd := exec.Command("bash", "-c", scriptCmd)
-	bashCmd.Stdout = os.Stdout
-	bashCmd.Stderr = os.Stderr
-	bashCmd.Stdin = os.Stdin
+	timeout, err := commandTimeout(cmd, cobraCmd)
+	if err != nil {
+		return err
+	}
+
+	shell := cfg.CommandShell(cmd)
+	script := scriptCmd
+	if cfg.IsStrict(cmd) {
+		script = strictScript(shell, script)
+	}
 
-	return bashCmd.Run()
+	spec := runSpec{dir: dir, env: env, timeout: timeout}
+	if shell.IsBuiltin() {
+		spec.script = script
+	} else {
+		args, cleanup, err := shellArgs(shell, script)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		if cmd.Container != nil {
+			args, err = containerArgs(cfg, cmd, ctx, dir, shell, args, cobraCmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			// The engine runs with kook's environment, the script with the
+			// container's
+			spec.env = nil
+			spec.container = true
+		}
+		spec.args = args
+	}
+
+	if err := runWithRetry(cmd, cobraCmd, func() error {
+		return runScript(cmd, cobraCmd, spec)
+	}); err != nil {
+		return err
+	}
+
+	if sum != "" {
+		if err := saveFingerprint(cfg, cmd, sum); err != nil {
+			return fmt.Errorf("failed to save fingerprint: %w", err)
+		}
+	}
+	return nil
+}
+
+// runSpec describes how to run a rendered script: as a process started
+// with args, or with the embedded shell when args is empty. container is set
+// when args run the script in a container.
+type runSpec struct {
+	args      []string
+	script    string
+	dir       string
+	env       []string
+	timeout   time.Duration
+	container bool
 }
 
-func getOptionValue(cobraCmd *cobra.Command, opt config.Option) (interface{}, error) {
+// runScript runs the rendered script with its shell, stopping it when the
+// command is cancelled or runs longer than its timeout
+func runScript(cmd config.Command, cobraCmd *cobra.Command, spec runSpec) error {
+	runCtx := cobraCmd.Context()
+	if spec.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, spec.timeout)
+		defer cancel()
+	}
+
+	var err error
+	if len(spec.args) == 0 {
+		err = runBuiltin(runCtx, cobraCmd, cmd.Name, spec)
+	} else if spec.container {
+		err = runContainer(runCtx, cobraCmd, cmd.Name, spec)
+	} else {
+		err = runProcess(runCtx, cobraCmd, spec)
+	}
+
+	if err != nil {
+		// Report why the script was stopped rather than the signal that ended it
+		if ctxErr := cobraCmd.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return &TimeoutError{Command: cmd.Name, Timeout: spec.timeout}
+		}
+		if errors.Is(err, context.Canceled) {
+			return errInterrupted
+		}
+		return err
+	}
+	return nil
+}
+
+// runProcess starts the script process and waits for it, stopping it when
+// ctx is done
+func runProcess(ctx context.Context, cobraCmd *cobra.Command, spec runSpec) error {
+	// Scripts that can be stopped early run in their own process group, so
+	// stopping them also stops everything they started: restarted and timed
+	// out scripts, and scripts without terminal input such as concurrent
+	// dependencies, cancelled when a sibling fails. Other scripts reading
+	// from the terminal stay in kook's process group.
+	stdin := cobraCmd.InOrStdin()
+	watch := BuiltinBool(cobraCmd, "watch")
+	processGroup := watch || spec.timeout > 0 || !isTerminal(stdin)
+	if processGroup {
+		// Stop the script when kook is interrupted or terminated; a script
+		// given the terminal's foreground gets Ctrl-C itself
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	execCmd := exec.CommandContext(ctx, spec.args[0], spec.args[1:]...)
+	execCmd.Dir = spec.dir
+	execCmd.Env = spec.env
+	execCmd.Stdout = cobraCmd.OutOrStdout()
+	execCmd.Stderr = cobraCmd.ErrOrStderr()
+	execCmd.Stdin = stdin
+	execCmd.WaitDelay = 100 * time.Millisecond
+
+	if processGroup {
+		release := useProcessGroup(execCmd, stdin)
+		defer release()
+	}
+
+	err := execCmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("shell '%s' not found: install it or set shell: builtin to use kook's embedded shell", spec.args[0])
+	}
+	if err != nil && ctx.Err() != nil {
+		// Let the caller report why the script was stopped
+		return ctx.Err()
+	}
+	return err
+}
+
+// commandDir returns the directory the script runs in: the command's dir,
+// rendered and resolved against the Kookfile directory, otherwise the
+// directory chosen by default_dir
+func commandDir(cfg *config.Config, cmd config.Command, ctx map[string]interface{}, invocationDir string) (string, error) {
+	if cmd.Dir == "" {
+		if cfg.DefaultDir == "kookfile" {
+			return cfg.Dir, nil
+		}
+		return invocationDir, nil
+	}
+
+	tmpl, err := template.New(cmd.Name + " dir").Parse(cmd.Dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse dir template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return "", fmt.Errorf("failed to execute dir template: %w", err)
+	}
+
+	// A template rendering nothing means the Kookfile directory
+	dir := cfg.Dir
+	if rendered := strings.TrimSpace(buf.String()); rendered != "" {
+		dir = cfg.ResolvePath(rendered)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("working directory '%s' does not exist", dir)
+	}
+	return dir, nil
+}
+
+// commandEnv returns the environment of the script: kook's own environment,
+// or only the env_passthrough variables with env_clear, plus the rendered
+// top-level and command env values. It returns nil when the environment is
+// inherited unchanged.
+func commandEnv(cfg *config.Config, cmd config.Command, ctx map[string]interface{}) ([]string, error) {
+	hermetic := cfg.EnvClear || cmd.EnvClear
+	if !hermetic && len(cfg.Env) == 0 && len(cmd.Env) == 0 {
+		return nil, nil
+	}
+
+	var env []string
+	if hermetic {
+		for _, name := range append(append([]string{}, cfg.EnvPassthrough...), cmd.EnvPassthrough...) {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	} else {
+		env = os.Environ()
+	}
+
+	// Command values come last so they override top-level ones
+	values, err := renderEnv(ctx, cfg.Env, cmd.Env)
+	if err != nil {
+		return nil, err
+	}
+	env = append(env, values...)
+
+	// An empty, non-nil environment keeps the script from inheriting kook's
+	if env == nil {
+		env = []string{}
+	}
+	return env, nil
+}
+
+// renderEnv renders env maps to NAME=value entries, in the order of the maps
+func renderEnv(ctx map[string]interface{}, maps ...map[string]string) ([]string, error) {
+	var env []string
+	for _, values := range maps {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			tmpl, err := template.New(name).Parse(values[name])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse env %s template: %w", name, err)
+			}
+
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, ctx); err != nil {
+				return nil, fmt.Errorf("failed to execute env %s template: %w", name, err)
+			}
+			env = append(env, name+"="+buf.String())
+		}
+	}
+	return env, nil
+}
+
+// commandTimeout returns how long the script may run: the --timeout flag when
+// given, otherwise the command's timeout. Zero means no limit.
+func commandTimeout(cmd config.Command, cobraCmd *cobra.Command) (time.Duration, error) {
+	if flag := BuiltinFlag(cobraCmd, "timeout"); flag != nil && flag.Changed {
+		return time.ParseDuration(flag.Value.String())
+	}
+	if cmd.Timeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cmd.Timeout)
+}
+
+// BuiltinFlag returns a flag of the root command, built-in flag or global
+// option, unless an option of the command with the same name takes it over
+func BuiltinFlag(cobraCmd *cobra.Command, name string) *pflag.Flag {
+	flag := cobraCmd.Flags().Lookup(name)
+	if flag == nil || flag != cobraCmd.Root().PersistentFlags().Lookup(name) {
+		return nil
+	}
+	return flag
+}
+
+// BuiltinBool reports whether a built-in bool flag is set. It is off for
+// commands with their own option of that name.
+func BuiltinBool(cobraCmd *cobra.Command, name string) bool {
+	flag := BuiltinFlag(cobraCmd, name)
+	return flag != nil && flag.Value.String() == "true"
+}
+
+func getOptionValue(cfg *config.Config, cobraCmd *cobra.Command, opt config.Option) (interface{}, error) {
 	switch opt.Type {
 	case "bool":
 		return cobraCmd.Flags().GetBool(opt.Name)
 	case "str":
 		return cobraCmd.Flags().GetString(opt.Name)
+	case "path", "file", "dir":
+		val, err := cobraCmd.Flags().GetString(opt.Name)
+		return cfg.ResolveOptionPath(val, cobraCmd.Flags().Changed(opt.Name)), err
+	case "duration":
+		flag := cobraCmd.Flags().Lookup(opt.Name)
+		if flag == nil {
+			return nil, fmt.Errorf("flag accessed but not defined: %s", opt.Name)
+		}
+		return Duration(flag.Value.String()), nil
 	case "int":
 		return cobraCmd.Flags().GetInt(opt.Name)
 	case "float":
 		return cobraCmd.Flags().GetFloat64(opt.Name)
+	case "count":
+		val, err := cobraCmd.Flags().GetCount(opt.Name)
+		return Count(val), err
 	default:
 		return nil, fmt.Errorf("unknown option type: %s", opt.Type)
 	}
 }
+
+func passthroughArgs(cobraCmd *cobra.Command) Args {
+	args := cobraCmd.Flags().Args()
+	dash := cobraCmd.ArgsLenAtDash()
+	if dash < 0 {
+		return Args{}
+	}
+	return Args(args[dash:])
+}
+
+// redact masks every occurrence of the secret values in text
+func redact(text string, secrets []string) string {
+	// Replace longer secrets first so overlapping values are fully masked
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, secret := range sorted {
+		text = strings.ReplaceAll(text, secret, "****")
+	}
+	return text
+}
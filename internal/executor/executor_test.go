@@ -0,0 +1,646 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// Test passthrough arguments rendering
+func TestArgsString(t *testing.T) {
+	tests := []struct {
+		args     Args
+		expected string
+	}{
+		{Args{}, ""},
+		{Args{"-run", "TestFoo", "-v"}, "-run TestFoo -v"},
+		{Args{"-run", "Test Foo"}, "-run 'Test Foo'"},
+		{Args{""}, "''"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.args.String(); actual != tt.expected {
+			t.Errorf("Args%q.String() = %q, expected %q", []string(tt.args), actual, tt.expected)
+		}
+	}
+}
+
+// Test duration unit helpers
+func TestDurationHelpers(t *testing.T) {
+	tests := []struct {
+		duration     Duration
+		seconds      float64
+		milliseconds int64
+	}{
+		{"30s", 30, 30000},
+		{"5m", 300, 300000},
+		{"1500ms", 1.5, 1500},
+		{"", 0, 0},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.duration.Seconds(); actual != tt.seconds {
+			t.Errorf("Duration(%q).Seconds() = %v, expected %v", tt.duration, actual, tt.seconds)
+		}
+		if actual := tt.duration.Milliseconds(); actual != tt.milliseconds {
+			t.Errorf("Duration(%q).Milliseconds() = %v, expected %v", tt.duration, actual, tt.milliseconds)
+		}
+	}
+}
+
+// Test secret redaction in the echoed script
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		text     string
+		secrets  []string
+		expected string
+	}{
+		{"psql -p s3cr3t", nil, "psql -p s3cr3t"},
+		{"PGPASSWORD=s3cr3t psql -c 's3cr3t'", []string{"s3cr3t"}, "PGPASSWORD=**** psql -c '****'"},
+		{"login abc abcdef", []string{"abc", "abcdef"}, "login **** ****"},
+		{"login user pass", []string{"user", "pass"}, "login **** ****"},
+	}
+
+	for _, tt := range tests {
+		if actual := redact(tt.text, tt.secrets); actual != tt.expected {
+			t.Errorf("redact(%q, %q) = %q, expected %q", tt.text, tt.secrets, actual, tt.expected)
+		}
+	}
+}
+
+// Test count flag rebuilding
+func TestCountRepeat(t *testing.T) {
+	tests := []struct {
+		count    Count
+		expected string
+	}{
+		{0, ""},
+		{1, "v"},
+		{3, "vvv"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.count.Repeat("v"); actual != tt.expected {
+			t.Errorf("Count(%d).Repeat(\"v\") = %q, expected %q", tt.count, actual, tt.expected)
+		}
+	}
+}
+
+// Test up-to-date checks for commands with sources
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{Dir: dir}
+	cmd := config.Command{Name: "build", Sources: []string{"src/**/*.txt"}, Generates: []string{"out.txt"}}
+
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sumOf := func(script string, values map[string]string) string {
+		sum, err := fingerprint(cfg, cmd, script, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	upToDate := func(sum string) bool {
+		ok, err := isUpToDate(cfg, cmd, sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	write("src/a/one.txt", "one")
+	sum := sumOf("make", map[string]string{"tag": "v1"})
+
+	if upToDate(sum) {
+		t.Error("Expected command without a stored fingerprint to be out of date")
+	}
+
+	write("out.txt", "built")
+	if err := saveFingerprint(cfg, cmd, sum); err != nil {
+		t.Fatal(err)
+	}
+	if !upToDate(sum) {
+		t.Error("Expected command to be up to date after saving its fingerprint")
+	}
+
+	if sumOf("make", map[string]string{"tag": "v2"}) == sum {
+		t.Error("Expected option values to change the fingerprint")
+	}
+	if sumOf("make all", map[string]string{"tag": "v1"}) == sum {
+		t.Error("Expected the script to change the fingerprint")
+	}
+
+	write("src/a/one.txt", "changed")
+	if sumOf("make", map[string]string{"tag": "v1"}) == sum {
+		t.Error("Expected source content to change the fingerprint")
+	}
+
+	os.Remove(filepath.Join(dir, "out.txt"))
+	if upToDate(sum) {
+		t.Error("Expected command with missing outputs to be out of date")
+	}
+}
+
+// Test working directory selection
+func TestCommandDir(t *testing.T) {
+	kookfileDir := t.TempDir()
+	invocationDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(kookfileDir, "services", "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := map[string]interface{}{"service": "api", "invocation_dir": invocationDir}
+	tests := []struct {
+		name       string
+		defaultDir string
+		dir        string
+		expected   string
+		wantErr    bool
+	}{
+		{"invocation by default", "", "", invocationDir, false},
+		{"kookfile default", "kookfile", "", kookfileDir, false},
+		{"invocation default", "invocation", "", invocationDir, false},
+		{"relative to kookfile", "invocation", "services/api", filepath.Join(kookfileDir, "services", "api"), false},
+		{"templated", "", "services/{{ .service }}", filepath.Join(kookfileDir, "services", "api"), false},
+		{"template using invocation dir", "kookfile", "{{ .invocation_dir }}", invocationDir, false},
+		{"missing directory", "", "services/web", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Dir: kookfileDir, DefaultDir: tt.defaultDir}
+			dir, err := commandDir(cfg, config.Command{Name: "test", Dir: tt.dir}, ctx, invocationDir)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got directory %s", dir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dir != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, dir)
+			}
+		})
+	}
+}
+
+// Test script environment construction
+func TestCommandEnv(t *testing.T) {
+	t.Setenv("KOOK_TEST_KEEP", "kept")
+	t.Setenv("KOOK_TEST_DROP", "dropped")
+
+	lookup := func(env []string, name string) (string, bool) {
+		value, found := "", false
+		for _, entry := range env {
+			if k, v, ok := strings.Cut(entry, "="); ok && k == name {
+				value, found = v, true
+			}
+		}
+		return value, found
+	}
+
+	ctx := map[string]interface{}{"env": "prod"}
+
+	env, err := commandEnv(&config.Config{}, config.Command{}, ctx)
+	if err != nil || env != nil {
+		t.Errorf("Expected inherited environment, got %v (%v)", env, err)
+	}
+
+	cfg := &config.Config{Env: map[string]string{"STAGE": "{{ .env }}", "REGION": "eu"}}
+	cmd := config.Command{Env: map[string]string{"REGION": "us"}}
+	env, err = commandEnv(cfg, cmd, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := lookup(env, "STAGE"); v != "prod" {
+		t.Errorf("Expected rendered STAGE=prod, got %q", v)
+	}
+	if v, _ := lookup(env, "REGION"); v != "us" {
+		t.Errorf("Expected command env to override top-level env, got REGION=%q", v)
+	}
+	if _, ok := lookup(env, "KOOK_TEST_DROP"); !ok {
+		t.Error("Expected kook's environment to be inherited")
+	}
+
+	cmd = config.Command{EnvClear: true, EnvPassthrough: []string{"KOOK_TEST_KEEP", "KOOK_TEST_UNSET"}}
+	env, err = commandEnv(cfg, cmd, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := lookup(env, "KOOK_TEST_KEEP"); v != "kept" {
+		t.Errorf("Expected passthrough variable, got %q", v)
+	}
+	for _, name := range []string{"KOOK_TEST_DROP", "KOOK_TEST_UNSET"} {
+		if _, ok := lookup(env, name); ok {
+			t.Errorf("Expected %s to be cleared", name)
+		}
+	}
+	if v, _ := lookup(env, "REGION"); v != "eu" {
+		t.Errorf("Expected env values with env_clear, got REGION=%q", v)
+	}
+}
+
+// Test how scripts are passed to shells and interpreters
+func TestShellArgs(t *testing.T) {
+	args, cleanup, err := shellArgs(config.Shell{"python3"}, "print(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if strings.Join(args, " ") != "python3 -c print(1)" {
+		t.Errorf("Expected inline python script, got %v", args)
+	}
+
+	args, cleanup, err = shellArgs(config.Shell{"/usr/local/bin/node"}, "console.log(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if len(args) != 3 || args[1] != "-e" {
+		t.Errorf("Expected inline node script, got %v", args)
+	}
+
+	args, cleanup, err = shellArgs(config.Shell{"deno", "run"}, "console.log(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || args[0] != "deno" || args[1] != "run" {
+		t.Fatalf("Expected script file appended to the command line, got %v", args)
+	}
+	content, err := os.ReadFile(args[2])
+	if err != nil || string(content) != "console.log(1)" {
+		t.Errorf("Expected script file with the script, got %q (%v)", content, err)
+	}
+
+	cleanup()
+	if _, err := os.Stat(args[2]); !os.IsNotExist(err) {
+		t.Error("Expected cleanup to remove the script file")
+	}
+}
+
+// Test running scripts with the embedded shell
+func TestRunBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetOut(&out)
+	cobraCmd.SetIn(strings.NewReader(""))
+
+	spec := runSpec{
+		script: `echo "$GREETING from ${PWD##*/}"`,
+		dir:    dir,
+		env:    []string{"GREETING=hello"},
+	}
+	if err := runBuiltin(context.Background(), cobraCmd, "test", spec); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "hello from " + filepath.Base(dir) + "\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	// The embedded shell keeps copying stdin after a run, give it a new one
+	cobraCmd.SetIn(strings.NewReader(""))
+	spec.script = "exit 3"
+	err := runBuiltin(context.Background(), cobraCmd, "test", spec)
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected exit code 3, got %v", err)
+	}
+}
+
+// Test capturing the output of scripts, with the embedded shell as well
+func TestOutput(t *testing.T) {
+	dir := t.TempDir()
+	for _, shell := range []config.Shell{{"sh"}, {"builtin"}} {
+		out, err := Output(context.Background(), shell, dir, `echo "${PWD##*/}"; echo ignored >&2`)
+		if err != nil {
+			t.Fatalf("Unexpected error with %v: %v", shell, err)
+		}
+		if expected := filepath.Base(dir) + "\n"; string(out) != expected {
+			t.Errorf("Expected %q with %v, got %q", expected, shell, out)
+		}
+
+		if _, err := Output(context.Background(), shell, dir, "exit 2"); err == nil {
+			t.Errorf("Expected a failing script to fail with %v", shell)
+		}
+	}
+}
+
+// Test strict mode preambles
+func TestStrictScript(t *testing.T) {
+	tests := []struct {
+		shell    config.Shell
+		expected string
+	}{
+		{config.Shell{"bash"}, "set -euo pipefail\nmake"},
+		{config.Shell{"/bin/sh"}, "set -eu\nmake"},
+		{config.Shell{"builtin"}, "set -euo pipefail\nmake"},
+		{config.Shell{"bash", "-x"}, "set -euo pipefail\nmake"},
+		{config.Shell{"python3"}, "make"},
+	}
+
+	for _, tt := range tests {
+		if actual := strictScript(tt.shell, "make"); actual != tt.expected {
+			t.Errorf("For %v expected %q, got %q", tt.shell, tt.expected, actual)
+		}
+	}
+}
+
+// fakeEngine puts a fake container engine named name on PATH, running script
+func fakeEngine(t *testing.T, name, script string) string {
+	dir := t.TempDir()
+	engine := filepath.Join(dir, name)
+	if err := os.WriteFile(engine, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return engine
+}
+
+// Test container engine selection
+func TestContainerEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake engines are shell scripts")
+	}
+
+	podman := fakeEngine(t, "podman", `echo "$@"`)
+	if engine, err := containerEngine(""); err != nil || engine != podman {
+		t.Errorf("Expected podman when docker is missing, got %q (%v)", engine, err)
+	}
+	if _, err := containerEngine("docker"); err == nil {
+		t.Error("Expected error for a missing engine")
+	}
+
+	t.Setenv("PATH", "")
+	if _, err := containerEngine(""); err == nil {
+		t.Error("Expected error without any engine")
+	}
+}
+
+// Test the command line running a script in a container
+func TestContainerArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake engines are shell scripts")
+	}
+
+	docker := fakeEngine(t, "docker", `echo "$@"`)
+	cfg := &config.Config{Dir: "/home/me/project", Env: map[string]string{"STAGE": "{{ .env }}"}, EnvPassthrough: []string{"GOPROXY"}}
+	cmd := config.Command{
+		Name: "build",
+		Env:  map[string]string{"GOOS": "linux"},
+		Container: &config.Container{
+			Image:   "golang:{{ .go }}",
+			Volumes: []string{"./.cache:/root/.cache", "gomod:/go/pkg/mod"},
+			Workdir: "/src",
+			Env:     map[string]string{"CGO_ENABLED": "0"},
+		},
+	}
+	ctx := map[string]interface{}{"env": "dev", "go": "1.22"}
+	shell := config.Shell{"bash"}
+
+	args, err := containerArgs(cfg, cmd, ctx, "/home/me/project/cmd", shell, []string{"bash", "-c", "go build"}, strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Root runs as the image's root user, with its home
+	user, home := []string{}, []string{}
+	if os.Getuid() > 0 {
+		user = []string{"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())}
+		home = []string{"-e", "HOME=/tmp"}
+	}
+
+	expected := append([]string{docker, "run", "--rm", "-i", "--init"}, user...)
+	expected = append(expected,
+		"-v", "/home/me/project:/src",
+		"-v", "/home/me/project/.cache:/root/.cache",
+		"-v", "gomod:/go/pkg/mod",
+		"-w", "/src/cmd",
+	)
+	expected = append(expected, home...)
+	expected = append(expected,
+		"-e", "GOPROXY",
+		"-e", "STAGE=dev",
+		"-e", "GOOS=linux",
+		"-e", "CGO_ENABLED=0",
+		"golang:1.22",
+		"bash", "-c", "go build",
+	)
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	// Without a workdir the project keeps its path, and directories outside
+	// it fall back to the project. A configured HOME is kept.
+	cmd.Container = &config.Container{Image: "alpine", Engine: "docker", Env: map[string]string{"HOME": "/home/dev"}}
+	args, err = containerArgs(cfg, cmd, ctx, "/tmp", config.Shell{"deno", "run"}, []string{"deno", "run", "/tmp/kook-script-1"}, strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, part := range []string{"-v /home/me/project:/home/me/project", "-v /tmp/kook-script-1:/tmp/kook-script-1:ro", "-w /home/me/project", "-e HOME=/home/dev", "alpine deno run /tmp/kook-script-1"} {
+		if !strings.Contains(joined, part) {
+			t.Errorf("Expected %q in %v", part, args)
+		}
+	}
+	if strings.Contains(joined, "HOME=/tmp") {
+		t.Errorf("Expected the configured HOME only, got %v", args)
+	}
+}
+
+// Test that the container of a stopped script is killed
+func TestRunContainerStopped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake engines are shell scripts")
+	}
+
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	log := filepath.Join(t.TempDir(), "engine.log")
+	docker := fakeEngine(t, "docker", `echo "$@" >> "`+log+`"; if [ "$1" = run ]; then exec `+sleep+` 30; fi`)
+
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetOut(&bytes.Buffer{})
+	cobraCmd.SetErr(&bytes.Buffer{})
+	cobraCmd.SetIn(strings.NewReader(""))
+	cobraCmd.SetContext(context.Background())
+
+	spec := runSpec{
+		args:      []string{docker, "run", "--rm", "alpine", "sh", "-c", "sleep 30"},
+		timeout:   200 * time.Millisecond,
+		container: true,
+	}
+	err = runScript(config.Command{Name: "serve"}, cobraCmd, spec)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "run --name kook-serve-") || !strings.HasPrefix(lines[1], "kill kook-serve-") {
+		t.Fatalf("Expected a named run then a kill, got %q", lines)
+	}
+	name := strings.Fields(lines[0])[2]
+	if lines[1] != "kill "+name {
+		t.Errorf("Expected the run container %s to be killed, got %q", name, lines[1])
+	}
+}
+
+// retryCommand returns a command to drive runWithRetry with, and its stderr
+func retryCommand(retry *config.Retry) (config.Command, *cobra.Command, *bytes.Buffer) {
+	var stderr bytes.Buffer
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetErr(&stderr)
+	cobraCmd.SetContext(context.Background())
+	return config.Command{Name: "flaky", Retry: retry}, cobraCmd, &stderr
+}
+
+// failWith returns a run function failing with each error in turn, then
+// succeeding, and counts its calls
+func failWith(calls *int, errs ...error) func() error {
+	return func() error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+// Test retrying failed scripts
+func TestRunWithRetry(t *testing.T) {
+	// Retried until it succeeds
+	cmd, cobraCmd, stderr := retryCommand(&config.Retry{Attempts: 3})
+	var calls int
+	if err := runWithRetry(cmd, cobraCmd, failWith(&calls, &exitError{code: 1})); err != nil || calls != 2 {
+		t.Errorf("Expected success on the second attempt, got %v after %d calls", err, calls)
+	}
+	if !strings.Contains(stderr.String(), "Attempt 1/3 of flaky failed with exit code 1, retrying in 0s") {
+		t.Errorf("Expected the failed attempt to be logged, got %q", stderr.String())
+	}
+
+	// Stops at attempts and reports every result
+	cmd, cobraCmd, _ = retryCommand(&config.Retry{Attempts: 3})
+	calls = 0
+	err := runWithRetry(cmd, cobraCmd, failWith(&calls, &exitError{code: 1}, &exitError{code: 2}, &exitError{code: 3}, &exitError{code: 4}))
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	if err == nil || err.Error() != "command 'flaky' failed after 3 attempts (exit code 1, exit code 2, exit code 3): exit status 3" {
+		t.Errorf("Expected the attempts in the error, got %v", err)
+	}
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected the last exit code to be kept, got %v", err)
+	}
+
+	// Only listed exit codes are retried
+	cmd, cobraCmd, _ = retryCommand(&config.Retry{Attempts: 5, OnExitCodes: []int{75}})
+	calls = 0
+	err = runWithRetry(cmd, cobraCmd, failWith(&calls, &exitError{code: 75}, &exitError{code: 1}))
+	if calls != 2 || err == nil || !strings.Contains(err.Error(), "failed after 2 attempts (exit code 75, exit code 1)") {
+		t.Errorf("Expected exit code 1 to stop retrying, got %v after %d calls", err, calls)
+	}
+
+	cmd, cobraCmd, _ = retryCommand(&config.Retry{Attempts: 5, OnExitCodes: []int{75}})
+	calls = 0
+	err = runWithRetry(cmd, cobraCmd, failWith(&calls, &exitError{code: 1}))
+	if calls != 1 || err == nil || err.Error() != "exit status 1" {
+		t.Errorf("Expected a single failure to be returned as is, got %v after %d calls", err, calls)
+	}
+
+	// Timeouts are not retried
+	cmd, cobraCmd, _ = retryCommand(&config.Retry{Attempts: 3})
+	calls = 0
+	err = runWithRetry(cmd, cobraCmd, failWith(&calls, &TimeoutError{Command: "flaky", Timeout: time.Second}))
+	var timeoutErr *TimeoutError
+	if calls != 1 || !errors.As(err, &timeoutErr) {
+		t.Errorf("Expected a timeout not to be retried, got %v after %d calls", err, calls)
+	}
+}
+
+// Test that exponential backoff doubles the delay after each attempt
+func TestRunWithRetryBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		backoff string
+		delays  []string
+	}{
+		{"constant", []string{"1ms", "1ms", "1ms"}},
+		{"exponential", []string{"1ms", "2ms", "4ms"}},
+	} {
+		cmd, cobraCmd, stderr := retryCommand(&config.Retry{Attempts: 4, Delay: "1ms", Backoff: tt.backoff})
+		var calls int
+		fail := &exitError{code: 1}
+		runWithRetry(cmd, cobraCmd, failWith(&calls, fail, fail, fail, fail))
+
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if len(lines) != len(tt.delays) {
+			t.Fatalf("Expected %d retries with %s backoff, got %q", len(tt.delays), tt.backoff, stderr.String())
+		}
+		for i, delay := range tt.delays {
+			if !strings.HasSuffix(lines[i], "retrying in "+delay) {
+				t.Errorf("Expected retry %d to wait %s with %s backoff, got %q", i+1, delay, tt.backoff, lines[i])
+			}
+		}
+	}
+}
+
+// Test that command options take over built-in flags of the same name
+func TestBuiltinFlag(t *testing.T) {
+	root := &cobra.Command{Use: "kook"}
+	root.PersistentFlags().Bool("force", false, "")
+	plain := &cobra.Command{Use: "build", Run: func(*cobra.Command, []string) {}}
+	own := &cobra.Command{Use: "deploy", Run: func(*cobra.Command, []string) {}}
+	own.Flags().String("force", "", "")
+	root.AddCommand(plain, own)
+
+	for _, tt := range []struct {
+		cmd      *cobra.Command
+		args     []string
+		expected bool
+	}{
+		{plain, []string{"build"}, false},
+		{plain, []string{"build", "--force"}, true},
+		{own, []string{"deploy", "--force", "true"}, false},
+	} {
+		root.SetArgs(tt.args)
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if actual := BuiltinBool(tt.cmd, "force"); actual != tt.expected {
+			t.Errorf("For %v expected %v, got %v", tt.args, tt.expected, actual)
+		}
+	}
+	if BuiltinFlag(own, "force") != nil {
+		t.Error("Expected no built-in flag for a command with its own option")
+	}
+}
@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"kook/internal/config"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// stateDir is the directory, next to the Kookfile, where kook keeps the
+// fingerprints of commands with sources
+const stateDir = ".kook"
+
+// fingerprint hashes everything a command's result depends on: the content
+// of its source files, the rendered script and the option values
+func fingerprint(cfg *config.Config, cmd config.Command, script string, values map[string]string) (string, error) {
+	files, err := globFiles(cfg, cmd.Sources)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "script\x00%s\x00", script)
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "option\x00%s\x00%s\x00", name, values[name])
+	}
+
+	for _, file := range files {
+		sum, err := hashFile(file)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(cfg.Dir, file)
+		fmt.Fprintf(h, "source\x00%s\x00%s\x00", filepath.ToSlash(rel), sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isUpToDate reports whether the command last succeeded with the same
+// fingerprint and every generates pattern still matches a file
+func isUpToDate(cfg *config.Config, cmd config.Command, sum string) (bool, error) {
+	stored, err := os.ReadFile(fingerprintPath(cfg, cmd))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(stored) != sum {
+		return false, nil
+	}
+
+	for _, pattern := range cmd.Generates {
+		matches, err := doublestar.FilepathGlob(cfg.ResolvePath(pattern))
+		if err != nil {
+			return false, err
+		}
+		if len(matches) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// saveFingerprint records a successful run of the command
+func saveFingerprint(cfg *config.Config, cmd config.Command, sum string) error {
+	path := fingerprintPath(cfg, cmd)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Keep the state directory out of version control
+	ignore := filepath.Join(cfg.Dir, stateDir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := os.WriteFile(ignore, []byte("*\n"), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, []byte(sum), 0o644)
+}
+
+func fingerprintPath(cfg *config.Config, cmd config.Command) string {
+	return filepath.Join(cfg.Dir, stateDir, "fingerprints", cmd.Name)
+}
+
+// globFiles returns the sorted regular files matching any of the patterns,
+// which are relative to the Kookfile directory
+func globFiles(cfg *config.Config, patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	for _, pattern := range patterns {
+		matches, err := doublestar.FilepathGlob(cfg.ResolvePath(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
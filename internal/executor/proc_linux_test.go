@@ -0,0 +1,112 @@
+//go:build linux
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal returns both sides of a new pseudo terminal
+func openTerminal(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("No pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	return master, slave
+}
+
+// Test that a script with a timeout still reads from the terminal, and that
+// kook gets the terminal back afterwards. The test binary runs itself in a
+// session whose terminal is a new pseudo terminal.
+func TestRunScriptTerminal(t *testing.T) {
+	if os.Getenv("KOOK_TERMINAL_TEST") == "1" {
+		runScriptInTerminal()
+		return
+	}
+
+	master, slave := openTerminal(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunScriptTerminal$")
+	cmd.Env = append(os.Environ(), "KOOK_TERMINAL_TEST=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, master)
+		output <- buf.String()
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	master.Write([]byte("hello\n"))
+
+	done := make(chan error)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the script to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("Expected the script to read from the terminal")
+	}
+
+	master.Close()
+	out := <-output
+	for _, want := range []string{"got=hello", "foreground=true"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output, got %q", want, out)
+		}
+	}
+}
+
+func runScriptInTerminal() {
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetContext(context.Background())
+
+	spec := runSpec{
+		args:    []string{"sh", "-c", `read x; echo got=$x`},
+		timeout: 3 * time.Second,
+	}
+	if err := runScript(config.Command{Name: "read"}, cobraCmd, spec); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("foreground=%t\n", inForeground(os.Stdin))
+	os.Exit(0)
+}
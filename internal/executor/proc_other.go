@@ -0,0 +1,14 @@
+//go:build !unix
+
+package executor
+
+import (
+	"io"
+	"os/exec"
+)
+
+// useProcessGroup is a no-op where process groups are not available; the
+// script process alone is stopped
+func useProcessGroup(cmd *exec.Cmd, stdin io.Reader) func() {
+	return func() {}
+}
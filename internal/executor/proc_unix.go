@@ -0,0 +1,68 @@
+//go:build unix
+
+package executor
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// useProcessGroup starts the script in its own process group, so that
+// stopping it also stops every process it started. Stopping sends SIGTERM,
+// then SIGKILL to what is left after a grace period. A script reading from
+// the terminal gets the terminal's foreground, so it keeps its input and
+// Ctrl-C. The returned function must be called once the script has exited:
+// it cancels the pending SIGKILL, so it never hits a process group reused
+// after the script's, kills what a stopped script left behind and gives the
+// terminal back to kook.
+func useProcessGroup(cmd *exec.Cmd, stdin io.Reader) func() {
+	var kill *time.Timer
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	tty, foreground := stdin.(*os.File)
+	if foreground = foreground && inForeground(tty); foreground {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(tty.Fd())
+	}
+
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		kill = time.AfterFunc(killGracePeriod, func() {
+			syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killGracePeriod + cmd.WaitDelay
+
+	// Wait returns after Cancel, so kill is set by then if the script was
+	// stopped
+	return func() {
+		if kill != nil && kill.Stop() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		if foreground {
+			takeTerminal(int(tty.Fd()))
+		}
+	}
+}
+
+// inForeground reports whether f is a terminal of which kook's process group
+// is the foreground: kook run in the background keeps its scripts there too
+func inForeground(f *os.File) bool {
+	pgid, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgid == syscall.Getpgrp()
+}
+
+// takeTerminal makes kook's process group the terminal's foreground again.
+// Kook is in the background until then, and would be stopped by SIGTTOU.
+func takeTerminal(fd int) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp())
+}
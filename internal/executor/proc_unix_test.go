@@ -0,0 +1,66 @@
+//go:build unix
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// Test that a timed out script is stopped along with the processes it started
+func TestRunScriptTimeout(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	cobraCmd := &cobra.Command{}
+	cobraCmd.SetOut(&bytes.Buffer{})
+	cobraCmd.SetErr(&bytes.Buffer{})
+	cobraCmd.SetIn(strings.NewReader(""))
+	cobraCmd.SetContext(context.Background())
+
+	spec := runSpec{
+		args:    []string{"sh", "-c", `echo $$ > "$PID_FILE"; sleep 30 & sleep 30; wait`},
+		env:     append(os.Environ(), "PID_FILE="+pidFile),
+		timeout: 200 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := runScript(config.Command{Name: "slow"}, cobraCmd, spec)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != spec.timeout {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > killGracePeriod {
+		t.Errorf("Expected the script to stop on SIGTERM, took %s", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopped processes are reaped by init shortly after
+	for deadline := time.Now().Add(killGracePeriod); ; time.Sleep(20 * time.Millisecond) {
+		if err := syscall.Kill(-pgid, 0); errors.Is(err, syscall.ESRCH) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the script's process group to be gone")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// runWithRetry calls run, calling it again after a delay while the script
+// fails with an exit code the command retries on. Timeouts and interruptions
+// are not retried.
+func runWithRetry(cmd config.Command, cobraCmd *cobra.Command, run func() error) error {
+	retry := cmd.Retry
+	if retry == nil || retry.Attempts <= 1 {
+		return run()
+	}
+
+	delay, _ := time.ParseDuration(retry.Delay)
+	stderr := cobraCmd.ErrOrStderr()
+
+	var results []string
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil {
+			return nil
+		}
+
+		// Script processes and the embedded shell both report exit codes
+		var exitErr interface{ ExitCode() int }
+		retryable := errors.As(err, &exitErr) && retry.RetriesOn(exitErr.ExitCode())
+		if exitErr != nil {
+			results = append(results, fmt.Sprintf("exit code %d", exitErr.ExitCode()))
+		} else {
+			results = append(results, err.Error())
+		}
+
+		if !retryable || attempt >= retry.Attempts {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("command '%s' failed after %d attempts (%s): %w", cmd.Name, attempt, strings.Join(results, ", "), err)
+		}
+
+		fmt.Fprintf(stderr, "Attempt %d/%d of %s failed with %s, retrying in %s\n",
+			attempt, retry.Attempts, cmd.Name, results[attempt-1], delay)
+
+		select {
+		case <-time.After(delay):
+		case <-cobraCmd.Context().Done():
+			return cobraCmd.Context().Err()
+		}
+
+		if retry.Backoff == "exponential" {
+			delay *= 2
+		}
+	}
+}
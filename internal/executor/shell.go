@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kook/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// inlineFlags are the flags passing a script as an argument, for the shells
+// and interpreters that have one. Other programs get the script as a file.
+var inlineFlags = map[string]string{
+	"sh":      "-c",
+	"bash":    "-c",
+	"zsh":     "-c",
+	"dash":    "-c",
+	"ksh":     "-c",
+	"fish":    "-c",
+	"python":  "-c",
+	"python3": "-c",
+	"node":    "-e",
+	"perl":    "-e",
+	"ruby":    "-e",
+}
+
+// strictPreambles make shell scripts stop at the first failing line.
+// Interpreters such as python or node already stop on errors.
+var strictPreambles = map[string]string{
+	"sh":      "set -eu",
+	"dash":    "set -eu",
+	"bash":    "set -euo pipefail",
+	"zsh":     "set -euo pipefail",
+	"ksh":     "set -euo pipefail",
+	"builtin": "set -euo pipefail",
+}
+
+// strictScript prepends the shell's strict mode preamble to script. Scripts
+// for other interpreters are unchanged.
+func strictScript(shell config.Shell, script string) string {
+	preamble, ok := strictPreambles[filepath.Base(shell[0])]
+	if !ok {
+		return script
+	}
+	return preamble + "\n" + script
+}
+
+// inlineFlag returns the flag passing a script as an argument to shell, if
+// it has one. Shells given as a command line always get a file.
+func inlineFlag(shell config.Shell) (string, bool) {
+	if len(shell) != 1 {
+		return "", false
+	}
+	flag, ok := inlineFlags[filepath.Base(shell[0])]
+	return flag, ok
+}
+
+// shellArgs returns the command line running script with shell. Scripts for
+// programs without an inline flag are written to a temporary file whose path
+// is appended; the returned cleanup function removes it.
+func shellArgs(shell config.Shell, script string) ([]string, func(), error) {
+	if flag, ok := inlineFlag(shell); ok {
+		return []string{shell[0], flag, script}, func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "kook-script-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create script file: %w", err)
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+
+	if _, err := f.WriteString(script); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write script file: %w", err)
+	}
+
+	args := append(append([]string{}, shell...), f.Name())
+	return args, cleanup, nil
+}
+
+// Output runs script with shell in dir, without input, and returns its
+// standard output. The builtin shell runs it with the embedded interpreter.
+func Output(ctx context.Context, shell config.Shell, dir, script string) ([]byte, error) {
+	if shell.IsBuiltin() {
+		var out bytes.Buffer
+		cobraCmd := &cobra.Command{}
+		cobraCmd.SetIn(strings.NewReader(""))
+		cobraCmd.SetOut(&out)
+		cobraCmd.SetErr(io.Discard)
+		err := runBuiltin(ctx, cobraCmd, "script", runSpec{script: script, dir: dir})
+		return out.Bytes(), err
+	}
+
+	args, cleanup, err := shellArgs(shell, script)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = 100 * time.Millisecond
+	return cmd.Output()
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"kook/internal/cli"
+	"kook/internal/executor"
 )
 
 var version = "dev" // Default version, will be overridden at build time
@@ -12,6 +14,11 @@ var version = "dev" // Default version, will be overridden at build time
 func main() {
 	if err := cli.Execute(version); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+
+		var timeoutErr *executor.TimeoutError
+		if errors.As(err, &timeoutErr) {
+			os.Exit(executor.TimeoutExitCode)
+		}
 		os.Exit(1)
 	}
 }